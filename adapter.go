@@ -2,15 +2,25 @@ package line
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/line/line-bot-sdk-go/linebot"
 	"github.com/line/line-bot-sdk-go/linebot/httphandler"
 	"github.com/oklahomer/go-sarah/v2"
 	"github.com/oklahomer/go-sarah/v2/log"
+	"github.com/oklahomer/go-sarah/v2/retry"
+	"math"
+	"math/rand"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,19 +29,77 @@ const (
 	LINE sarah.BotType = "line"
 )
 
+type contextKey int
+
+const (
+	botTypeContextKey contextKey = iota
+	channelIDContextKey
+	headersContextKey
+	batchResultContextKey
+)
+
+// BotTypeFromContext returns sarah.BotType stored in the context that is passed to the event handler.
+func BotTypeFromContext(ctx context.Context) (sarah.BotType, bool) {
+	botType, ok := ctx.Value(botTypeContextKey).(sarah.BotType)
+	return botType, ok
+}
+
+// ChannelIDFromContext returns the channel ID stored in the context that is passed to the event handler.
+// The value is set when Config.ChannelID is configured.
+func ChannelIDFromContext(ctx context.Context) (string, bool) {
+	channelID, ok := ctx.Value(channelIDContextKey).(string)
+	return channelID, ok
+}
+
+// Default values of Config.Port and Config.Endpoint set by NewConfig.
+const (
+	defaultPort     = 8080
+	defaultEndpoint = "/callback"
+)
+
+// defaultSendConcurrency is the number of requests the fan-out operations such as PushToGroups and Profiles send at the same time
+// when Config.SendConcurrency is not positive.
+const defaultSendConcurrency = 10
+
 // Config contains some configuration variables for line Adapter.
 type Config struct {
 	ChannelToken  string `json:"channel_token" yaml:"channel_token"`
 	ChannelSecret string `json:"channel_secret" yaml:"channel_secret"`
+	ChannelID     string `json:"channel_id" yaml:"channel_id"`
 	HelpCommand   string `json:"help_command" yaml:"help_command"`
 	AbortCommand  string `json:"abort_command" yaml:"abort_command"`
+	StripPrefix   string `json:"strip_prefix" yaml:"strip_prefix"`
 	Port          int    `json:"port" yaml:"port"`
 	Endpoint      string `json:"endpoint" yaml:"endpoint"`
 	TLS           *struct {
 		CertFile string `json:"cert_file" yaml:"cert_file"`
 		KeyFile  string `json:"key_file" yaml:"key_file"`
 	} `json:"tls" yaml:"tls"`
-	ClientOptions []linebot.ClientOption
+	CallbackURL          string                                           `json:"callback_url" yaml:"callback_url"`
+	MaxEventAge          time.Duration                                    `json:"max_event_age" yaml:"max_event_age"`
+	APIEndpointBase      string                                           `json:"api_endpoint_base" yaml:"api_endpoint_base"`
+	SendTextFallback     bool                                             `json:"send_text_fallback" yaml:"send_text_fallback"`
+	EnqueueRetryPolicy   *retry.Policy                                    `json:"enqueue_retry_policy" yaml:"enqueue_retry_policy"`
+	MaxContentSize       int64                                            `json:"max_content_size" yaml:"max_content_size"`
+	CoalesceWindow       time.Duration                                    `json:"coalesce_window" yaml:"coalesce_window"`
+	PropagatedHeaders    []string                                         `json:"propagated_headers" yaml:"propagated_headers"`
+	EventHandlerTimeout  time.Duration                                    `json:"event_handler_timeout" yaml:"event_handler_timeout"`
+	ReplyTokenLifetime   time.Duration                                    `json:"reply_token_lifetime" yaml:"reply_token_lifetime"`
+	TemporaryContentPath string                                           `json:"temporary_content_path" yaml:"temporary_content_path"`
+	TemporaryContentTTL  time.Duration                                    `json:"temporary_content_ttl" yaml:"temporary_content_ttl"`
+	StickerKeywords      map[string]string                                `json:"sticker_keywords" yaml:"sticker_keywords"`
+	PathPrefix           string                                           `json:"path_prefix" yaml:"path_prefix"`
+	OnEvent              func(linebot.EventType, linebot.EventSourceType) `json:"-" yaml:"-"`
+	MaxEventsPerRequest  int                                              `json:"max_events_per_request" yaml:"max_events_per_request"`
+	OnBatchResult        func(total, enqueued, failed int)                `json:"-" yaml:"-"`
+	ReplyTimeout         time.Duration                                    `json:"reply_timeout" yaml:"reply_timeout"`
+	PushTimeout          time.Duration                                    `json:"push_timeout" yaml:"push_timeout"`
+	MaintenanceMode      bool                                             `json:"maintenance_mode" yaml:"maintenance_mode"`
+	MaintenanceMessage   string                                           `json:"maintenance_message" yaml:"maintenance_message"`
+	OnUnsupportedContent func(sarah.Output)                               `json:"-" yaml:"-"`
+	SynchronousHandling  bool                                             `json:"synchronous_handling" yaml:"synchronous_handling"`
+	SendConcurrency      int                                              `json:"send_concurrency" yaml:"send_concurrency"`
+	ClientOptions        []linebot.ClientOption
 }
 
 // NewConfig returns initialized Config struct with default settings.
@@ -39,15 +107,73 @@ type Config struct {
 // or direct assignment.
 func NewConfig() *Config {
 	return &Config{
-		ChannelToken:  "",
-		ChannelSecret: "",
-		HelpCommand:   ".help",
-		AbortCommand:  ".abort",
-		Port:          8080,
-		Endpoint:      "/callback",
-		TLS:           nil,
-		ClientOptions: nil,
+		ChannelToken:     "",
+		ChannelSecret:    "",
+		ChannelID:        "",
+		HelpCommand:      ".help",
+		AbortCommand:     ".abort",
+		StripPrefix:      "",
+		Port:             defaultPort,
+		Endpoint:         defaultEndpoint,
+		TLS:              nil,
+		CallbackURL:      "",
+		MaxEventAge:      0,
+		APIEndpointBase:  "",
+		SendTextFallback: false,
+		EnqueueRetryPolicy: &retry.Policy{
+			Trial:    3,
+			Interval: 100 * time.Millisecond,
+		},
+		MaxContentSize:       0,
+		CoalesceWindow:       0,
+		PropagatedHeaders:    nil,
+		EventHandlerTimeout:  0,
+		ReplyTokenLifetime:   1 * time.Minute,
+		TemporaryContentPath: "",
+		TemporaryContentTTL:  10 * time.Minute,
+		StickerKeywords:      nil,
+		PathPrefix:           "",
+		OnEvent:              nil,
+		MaxEventsPerRequest:  0,
+		OnBatchResult:        nil,
+		ReplyTimeout:         defaultSendTimeout,
+		PushTimeout:          defaultSendTimeout,
+		MaintenanceMode:      false,
+		MaintenanceMessage:   "Sorry, the bot is temporarily unavailable for maintenance. Please try again later.",
+		OnUnsupportedContent: nil,
+		SynchronousHandling:  false,
+		SendConcurrency:      defaultSendConcurrency,
+		ClientOptions:        nil,
+	}
+}
+
+// UnmarshalJSON decodes given JSON data into Config.
+// In addition to the regular keys, channelAccessToken and channelSecret are accepted so credentials can be copied from LINE Developers console as they are.
+// Values that are not included in the data remain untouched, so defaults set by NewConfig are preserved.
+func (config *Config) UnmarshalJSON(data []byte) error {
+	type alias Config
+	err := json.Unmarshal(data, (*alias)(config))
+	if err != nil {
+		return err
+	}
+
+	console := &struct {
+		ChannelAccessToken string `json:"channelAccessToken"`
+		ChannelSecret      string `json:"channelSecret"`
+	}{}
+	err = json.Unmarshal(data, console)
+	if err != nil {
+		return err
 	}
+
+	if console.ChannelAccessToken != "" {
+		config.ChannelToken = console.ChannelAccessToken
+	}
+	if console.ChannelSecret != "" {
+		config.ChannelSecret = console.ChannelSecret
+	}
+
+	return nil
 }
 
 // AdapterOption defines function signature that Adapter's functional option must satisfy.
@@ -63,6 +189,15 @@ func WithClient(client *linebot.Client) AdapterOption {
 
 // WithEventHandler creates AdapterOption with given function.
 // This function is called on event reception.
+//
+// The function is called synchronously within the webhook request handling,
+// and the HTTP response is returned to LINE only after the function returns.
+// Therefore, all inputs are already enqueued or dropped when LINE receives the response as long as the function does not start its own goroutine.
+// The exception is text inputs buffered with Config.CoalesceWindow, which are enqueued after the window.
+// The default event handler bounds the wait for a full input queue with Config.EventHandlerTimeout; an input that does not fit within the timeout is dropped.
+// When Config.SynchronousHandling is true, LINE receives 503 instead of 200 if some inputs passed to the enqueueing function fail and none is enqueued.
+// Config.OnBatchResult is called once per webhook request after all event handlers return, with the results of the inputs passed to the enqueueing function.
+// Keep the function quick since LINE regards slow responses as failed deliveries.
 func WithEventHandler(handler func(context.Context, *Config, []*linebot.Event, func(sarah.Input) error)) AdapterOption {
 	return func(adapter *Adapter) error {
 		adapter.eventHandler = handler
@@ -70,6 +205,44 @@ func WithEventHandler(handler func(context.Context, *Config, []*linebot.Event, f
 	}
 }
 
+// WithSourceEventHandler creates AdapterOption that registers given function for the events sent from given source type.
+// Events from the source type are passed to this function instead of the one given via WithEventHandler or the default one,
+// so one-on-one chats and group chats can be handled by entirely different logic.
+//
+//	line.NewAdapter(config, line.WithSourceEventHandler(linebot.EventSourceTypeGroup, handleGroupEvents))
+//
+// Events from other source types are still passed to the default event handler in the original order.
+func WithSourceEventHandler(sourceType linebot.EventSourceType, handler func(context.Context, *Config, []*linebot.Event, func(sarah.Input) error)) AdapterOption {
+	return func(adapter *Adapter) error {
+		if adapter.sourceEventHandlers == nil {
+			adapter.sourceEventHandlers = map[linebot.EventSourceType]func(context.Context, *Config, []*linebot.Event, func(sarah.Input) error){}
+		}
+		adapter.sourceEventHandlers[sourceType] = handler
+		return nil
+	}
+}
+
+// WithRequestErrorHandler creates AdapterOption with given function.
+// This function is called when a webhook request can not be parsed or its signature is invalid, instead of the default one that logs the request.
+// linebot.ErrInvalidSignature is given in the latter case, and the request is responded with 400 after the function returns.
+func WithRequestErrorHandler(handler func(error, *http.Request)) AdapterOption {
+	return func(adapter *Adapter) error {
+		adapter.requestErrorHandler = handler
+		return nil
+	}
+}
+
+// WithStore creates AdapterOption with given Store.
+// The Store holds the state of the adapter's stateful features such as the contents served by HostTemporaryContent.
+// Give a Store backed by shared storage when multiple bot instances run behind a load balancer.
+// In-memory Store is used by default.
+func WithStore(store Store) AdapterOption {
+	return func(adapter *Adapter) error {
+		adapter.store = store
+		return nil
+	}
+}
+
 // WithServerMux lets developer set mux.
 // Adapter.Run() starts a new HTTP server with http.DefaultServeMux by default when none is set.
 // Setting mux is useful when http.DefaultServeMux cannot be used because another HTTP server is running in the same process
@@ -83,19 +256,65 @@ func WithServerMux(mux *http.ServeMux) AdapterOption {
 
 // Adapter internally starts HTTP server to receive call from LINE.
 type Adapter struct {
-	client       *linebot.Client
-	eventHandler func(context.Context, *Config, []*linebot.Event, func(sarah.Input) error)
-	config       *Config
-	mux          *http.ServeMux
+	client              *linebot.Client
+	eventHandler        func(context.Context, *Config, []*linebot.Event, func(sarah.Input) error)
+	sourceEventHandlers map[linebot.EventSourceType]func(context.Context, *Config, []*linebot.Event, func(sarah.Input) error)
+	requestErrorHandler func(error, *http.Request)
+	config              *Config
+	mux                 *http.ServeMux
+	scheduler           *scheduler
+	sendSemaphore       chan struct{}
+	store               Store
+	contentHost         *contentHost
+	capture             *capture
+
+	// maintenance is 1 while in maintenance mode. This is initialized with Config.MaintenanceMode and can be toggled via SetMaintenanceMode.
+	maintenance int32
+
+	// notifyErr is given on Adapter.Run to escalate errors to go-sarah's core.
+	notifyErrMutex sync.RWMutex
+	notifyErr      func(error)
 }
 
 var _ sarah.Adapter = (*Adapter)(nil)
 
+// AdapterInterface defines the public surface of Adapter to send messages.
+// Adapter implements this, so developers can build a decorator that adds logging, metrics, and such
+// while still satisfying sarah.Adapter without embedding Adapter itself.
+//
+// This is intentionally kept small so a decorator does not have to implement every feature of Adapter.
+// Other features such as profile fetching and rich menu management are provided as methods of *Adapter;
+// hold *Adapter along with the decorator to use them.
+type AdapterInterface interface {
+	sarah.Adapter
+
+	// PushToGroups pushes given messages to all given groups.
+	PushToGroups(context.Context, []string, ...linebot.SendingMessage) error
+
+	// SchedulePush pushes given messages to given destination at the given time.
+	SchedulePush(context.Context, time.Time, string, ...linebot.SendingMessage) error
+}
+
+var _ AdapterInterface = (*Adapter)(nil)
+
 // NewAdapter creates new Adapter with given *Config and zero or more AdapterOption.
 func NewAdapter(config *Config, options ...AdapterOption) (*Adapter, error) {
 	adapter := &Adapter{
-		config:       config,
-		eventHandler: defaultEventHandler, // may be replaced with WithEventHandler option.
+		config:              config,
+		scheduler:           newScheduler(),
+		eventHandler:        defaultEventHandler,        // may be replaced with WithEventHandler option.
+		requestErrorHandler: defaultRequestErrorHandler, // may be replaced with WithRequestErrorHandler option.
+	}
+
+	// When callback URL is given, Port and Endpoint are derived from it so the three values stay consistent.
+	// The derived values are set to a copy so the caller's config is not modified.
+	if config.CallbackURL != "" {
+		derived, err := applyCallbackURL(config)
+		if err != nil {
+			return nil, err
+		}
+		adapter.config = derived
+		config = derived
 	}
 
 	for _, opt := range options {
@@ -105,10 +324,42 @@ func NewAdapter(config *Config, options ...AdapterOption) (*Adapter, error) {
 		}
 	}
 
+	// Check TLS files beforehand so a typo in the path does not surface as a cryptic error on Run.
+	if config.TLS != nil {
+		for _, file := range []string{config.TLS.CertFile, config.TLS.KeyFile} {
+			err := checkReadable(file)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.MaintenanceMode {
+		adapter.maintenance = 1
+	}
+
+	// See if store is set by WithStore option.
+	if adapter.store == nil {
+		adapter.store = NewInMemoryStore()
+	}
+
+	// Generated contents can only be served when their public URL can be derived.
+	// LINE accepts media only at HTTPS URLs, so an http callback URL can not be used as the base.
+	if config.TemporaryContentPath != "" {
+		if !strings.HasPrefix(config.CallbackURL, "https://") {
+			return nil, errors.New("an HTTPS callback URL is required to serve temporary contents")
+		}
+		adapter.contentHost = newContentHost(config.ChannelSecret, adapter.store)
+	}
+
 	// See if client is set by WithClient option.
 	// If not, use given configuration
 	if adapter.client == nil {
-		client, err := linebot.New(config.ChannelSecret, config.ChannelToken, config.ClientOptions...)
+		clientOptions := config.ClientOptions
+		if config.APIEndpointBase != "" {
+			clientOptions = append([]linebot.ClientOption{linebot.WithEndpointBase(config.APIEndpointBase)}, clientOptions...)
+		}
+		client, err := linebot.New(config.ChannelSecret, config.ChannelToken, clientOptions...)
 		if err != nil {
 			return nil, fmt.Errorf("error on linebot.Client construction: %s", err.Error())
 		}
@@ -119,9 +370,57 @@ func NewAdapter(config *Config, options ...AdapterOption) (*Adapter, error) {
 		adapter.mux = http.DefaultServeMux
 	}
 
+	// Share one limit among all fan-out operations so concurrent calls do not multiply the number of connections.
+	concurrency := config.SendConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultSendConcurrency
+	}
+	adapter.sendSemaphore = make(chan struct{}, concurrency)
+
 	return adapter, nil
 }
 
+func checkReadable(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("TLS file %q is not readable: %s", path, err.Error())
+	}
+	return file.Close()
+}
+
+// applyCallbackURL returns a copy of given config with Port and Endpoint derived from Config.CallbackURL.
+// The callback URL is the public URL LINE sends webhook requests to, which may differ from the address the adapter listens on
+// when TLS is terminated by a proxy or load balancer in front of the bot.
+// Therefore, Port is derived only when the URL contains an explicit port, and Config.TLS is not required for an https URL.
+// Port and Endpoint set to values other than NewConfig's defaults are regarded as explicit and are kept as they are.
+func applyCallbackURL(config *Config) (*Config, error) {
+	u, err := url.Parse(config.CallbackURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse callback URL: %s", err.Error())
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported callback URL scheme: %s", u.Scheme)
+	}
+
+	derived := *config
+	if u.Port() != "" && (config.Port == 0 || config.Port == defaultPort) {
+		derived.Port, err = strconv.Atoi(u.Port())
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in callback URL: %s", err.Error())
+		}
+	}
+
+	if config.Endpoint == "" || config.Endpoint == defaultEndpoint {
+		derived.Endpoint = u.Path
+		if derived.Endpoint == "" {
+			derived.Endpoint = "/"
+		}
+	}
+
+	return &derived, nil
+}
+
 // BotType returns BotType of this particular instance.
 func (adapter *Adapter) BotType() sarah.BotType {
 	return LINE
@@ -129,69 +428,469 @@ func (adapter *Adapter) BotType() sarah.BotType {
 
 // Run starts HTTP server to handle incoming request from LINE.
 func (adapter *Adapter) Run(ctx context.Context, enqueueInput func(sarah.Input) error, notifyErr func(error)) {
+	adapter.notifyErrMutex.Lock()
+	adapter.notifyErr = notifyErr
+	adapter.notifyErrMutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		adapter.scheduler.stop()
+	}()
+
 	err := adapter.listen(ctx, enqueueInput)
 	if err != nil {
 		notifyErr(err)
 	}
 }
 
+// ErrInvalidCredentials indicates that LINE rejected the configured channel access token.
+var ErrInvalidCredentials = errors.New("channel access token is invalid or revoked")
+
+// VerifyCredentials makes a cheap authenticated API call to see if the configured channel access token is still valid.
+// ErrInvalidCredentials is returned when LINE responds with 401 or 403; other errors are returned as they are.
+// Calling this on startup or in a health check detects a rotated token before users face broken replies.
+func (adapter *Adapter) VerifyCredentials(ctx context.Context) error {
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := adapter.client.GetMessageQuota().WithContext(reqCtx).Do()
+	if err == nil {
+		return nil
+	}
+
+	if apiErr, ok := err.(*linebot.APIError); ok {
+		if apiErr.Code == http.StatusUnauthorized || apiErr.Code == http.StatusForbidden {
+			return ErrInvalidCredentials
+		}
+	}
+
+	return err
+}
+
+// PushDestination represents a user, room, or group ID to push a message to.
+// When sarah.Output's destination is a plain string, the string is treated as a reply token;
+// when the destination is PushDestination, the message is pushed instead of replied.
+// This is useful to send a message after the reply token expires such as a reminder:
+//
+//	id := input.(line.ConversationIDer).ConversationID()
+//	// Later...
+//	bot.SendMessage(ctx, sarah.NewOutputMessage(line.PushDestination(id), linebot.NewTextMessage("Reminder!")))
+type PushDestination string
+
 // SendMessage let Bot send message to LINE.
 func (adapter *Adapter) SendMessage(ctx context.Context, output sarah.Output) {
-	replyToken, ok := output.Destination().(string)
-	if !ok {
-		log.Errorf("destination is not string. %#v.", output.Destination())
+	var send func([]linebot.SendingMessage) error
+	switch dest := output.Destination().(type) {
+	case string:
+		send = func(messages []linebot.SendingMessage) error {
+			err := adapter.reply(ctx, dest, messages)
+			if err != nil {
+				log.Errorf("error on message reply: %s", err.Error())
+				adapter.escalate(&SendingError{Destination: dest, Err: err})
+			}
+			return err
+		}
+
+	case PushDestination:
+		send = func(messages []linebot.SendingMessage) error {
+			err := adapter.push(ctx, string(dest), messages)
+			if err != nil {
+				log.Errorf("error on message push: %s", err.Error())
+				adapter.escalate(&SendingError{Destination: dest, Err: err})
+			}
+			return err
+		}
+
+	default:
+		log.Errorf("destination is neither reply token nor PushDestination. %#v.", output.Destination())
 		return
 	}
 
 	switch content := output.Content().(type) {
 	case []linebot.SendingMessage:
-		adapter.reply(ctx, replyToken, content)
+		send(content)
 
 	case linebot.SendingMessage:
-		adapter.reply(ctx, replyToken, []linebot.SendingMessage{content})
+		send([]linebot.SendingMessage{content})
 
 	case *sarah.CommandHelps:
-		var messages []linebot.SendingMessage
+		// Join the instructions into one text so the number of registered commands does not hit the limit of messages per call.
+		var instructions []string
 		for _, commandHelp := range *content {
-			messages = append(messages, linebot.NewTextMessage(commandHelp.Instruction))
+			instructions = append(instructions, commandHelp.Instruction)
+		}
+		send(SplitText(strings.Join(instructions, "\n"), 0))
+
+	case *FallbackContent:
+		messages := []linebot.SendingMessage{content.Rich}
+		if adapter.config.SendTextFallback {
+			messages = append(messages, linebot.NewTextMessage(content.Fallback))
+		}
+		send(messages)
+
+	case *DeferredContent:
+		send([]linebot.SendingMessage{content.Interim})
+		go func() {
+			messages, err := content.Task(ctx)
+			if err != nil {
+				log.Errorf("error on deferred task execution: %s", err.Error())
+				return
+			}
+			err = adapter.push(ctx, content.ConversationID, messages)
+			if err != nil {
+				log.Errorf("error on message push: %s", err.Error())
+				adapter.escalate(&SendingError{Destination: PushDestination(content.ConversationID), Err: err})
+			}
+		}()
+
+	case *RichMenuContent:
+		err := send([]linebot.SendingMessage{content.Message})
+		if err != nil {
+			// Keep the current rich menu so the visible menu does not drift from the conversation.
+			return
+		}
+		err = adapter.linkRichMenu(ctx, content.UserID, content.RichMenuID)
+		if err != nil {
+			log.Errorf("error on rich menu linking: %s", err.Error())
+			adapter.escalate(err)
 		}
-		adapter.reply(ctx, replyToken, messages)
 
 	default:
 		log.Warnf("unexpected output %#v", output)
+		if adapter.config.OnUnsupportedContent != nil {
+			adapter.config.OnUnsupportedContent(output)
+		}
+	}
+}
+
+// SendingError represents a failure on message delivery to LINE.
+//
+// This is escalated to go-sarah's core via the function given to Adapter.Run,
+// so a supervising function registered via sarah.RegisterBotErrorSupervisor can let registered sarah.Alerter implementations notify administrators:
+//
+//	sarah.RegisterBotErrorSupervisor(func(botType sarah.BotType, err error) *sarah.SupervisionDirective {
+//		if _, ok := err.(*line.SendingError); ok {
+//			return &sarah.SupervisionDirective{AlertingErr: err}
+//		}
+//		return nil
+//	})
+type SendingError struct {
+	// Destination is either a reply token or PushDestination.
+	Destination sarah.OutputDestination
+	Err         error
+}
+
+// Error returns the detailed error about the delivery failure.
+func (e *SendingError) Error() string {
+	return fmt.Sprintf("failed to send message to %v: %s", e.Destination, e.Err.Error())
+}
+
+func (adapter *Adapter) escalate(err error) {
+	adapter.notifyErrMutex.RLock()
+	notifyErr := adapter.notifyErr
+	adapter.notifyErrMutex.RUnlock()
+
+	if notifyErr != nil {
+		notifyErr(err)
 	}
 }
 
-func (adapter *Adapter) reply(ctx context.Context, replyToken string, message []linebot.SendingMessage) {
+// maxMessagesPerCall is the maximum number of messages that can be sent with a single reply or push request.
+// LINE rejects the entire request when this limit is exceeded.
+const maxMessagesPerCall = 5
+
+func (adapter *Adapter) reply(ctx context.Context, replyToken string, message []linebot.SendingMessage) error {
+	if len(message) > maxMessagesPerCall {
+		return fmt.Errorf("can not reply with %d messages at once. maximum is %d", len(message), maxMessagesPerCall)
+	}
+
+	if adapter.capture != nil {
+		adapter.capture.store(message)
+		return nil
+	}
+
 	call := adapter.client.ReplyMessage(replyToken, message...)
-	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	reqCtx, cancel := withTimeout(ctx, adapter.config.ReplyTimeout)
 	defer cancel()
 	call.WithContext(reqCtx)
 	_, err := call.Do()
-	if err != nil {
-		log.Errorf("error on message reply: %s", err.Error())
+	return err
+}
+
+func (adapter *Adapter) push(ctx context.Context, to string, message []linebot.SendingMessage) error {
+	if len(message) > maxMessagesPerCall {
+		return fmt.Errorf("can not push %d messages at once. maximum is %d", len(message), maxMessagesPerCall)
+	}
+
+	if adapter.capture != nil {
+		adapter.capture.store(message)
+		return nil
+	}
+
+	call := adapter.client.PushMessage(to, message...)
+	reqCtx, cancel := withTimeout(ctx, adapter.config.PushTimeout)
+	defer cancel()
+	call.WithContext(reqCtx)
+	_, err := call.Do()
+	return err
+}
+
+// defaultSendTimeout is the timeout of a reply or push call applied when Config.ReplyTimeout or Config.PushTimeout is zero.
+const defaultSendTimeout = 5 * time.Second
+
+// withTimeout derives a context with given timeout.
+// Zero is regarded as unset and defaultSendTimeout is applied, so a Config that omits the timeout still bounds the call.
+// A negative value disables the deadline, in which case a cancelable context without deadline is returned.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout < 0 {
+		return context.WithCancel(ctx)
+	}
+	if timeout == 0 {
+		timeout = defaultSendTimeout
 	}
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (adapter *Adapter) listen(ctx context.Context, enqueueInput func(sarah.Input) error) error {
+// Handler returns http.Handler that validates the signature of a webhook request from LINE and passes the parsed events to the event handler.
+// Adapter.Run registers this to the mux by itself, so developers do not usually have to call this.
+// This is handy to test the whole flow against httptest.Server.
+//
+// When Config.CoalesceWindow is positive, text inputs are buffered for the window after the request is handled,
+// and the ones still buffered when ctx is canceled are dropped.
+// Set Config.CoalesceWindow to zero in tests that expect inputs to be enqueued within the request.
+//
+// When Config.SynchronousHandling is true, the returned handler responds with 503 when some inputs fail and none is enqueued,
+// so LINE can redeliver the events if webhook redelivery is enabled on LINE Developers console.
+// A redelivery contains all events of the webhook, so 200 is still returned when only some inputs fail; otherwise the enqueued ones would be processed twice.
+// Such failed inputs are logged and reported via Config.OnBatchResult.
+// An event handler that acts on events without enqueueing inputs, such as on follow events, sees those events again on redelivery.
+// The SDK in use does not expose webhookEventId, so de-duplicate them by the event's timestamp and source if that matters.
+// Text inputs buffered with Config.CoalesceWindow are regarded as enqueued.
+func (adapter *Adapter) Handler(ctx context.Context, enqueueInput func(sarah.Input) error) (http.Handler, error) {
 	handler, err := httphandler.New(adapter.config.ChannelSecret, adapter.config.ChannelToken)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	handler.HandleEvents(func(events []*linebot.Event, _ *http.Request) {
-		adapter.eventHandler(ctx, adapter.config, events, enqueueInput)
+	if adapter.config.CoalesceWindow > 0 {
+		enqueueInput = newCoalescer(ctx, adapter.config, enqueueInput).enqueue
+	}
+
+	// Let the event handler and its downstream know which bot and channel the events belong to.
+	handlerCtx := context.WithValue(ctx, botTypeContextKey, LINE)
+	if adapter.config.ChannelID != "" {
+		handlerCtx = context.WithValue(handlerCtx, channelIDContextKey, adapter.config.ChannelID)
+	}
+
+	handler.HandleEvents(func(events []*linebot.Event, req *http.Request) {
+		// Be defensive against a payload that claims an unreasonable number of events.
+		if limit := adapter.config.MaxEventsPerRequest; limit > 0 && len(events) > limit {
+			log.Warnf("%d events are given in one request. Only the first %d events are processed.", len(events), limit)
+			events = events[:limit]
+		}
+
+		// Count every accepted event, including the ones only answered with the maintenance message.
+		if adapter.config.OnEvent != nil {
+			for _, event := range events {
+				var sourceType linebot.EventSourceType
+				if event.Source != nil {
+					sourceType = event.Source.Type
+				}
+				adapter.config.OnEvent(event.Type, sourceType)
+			}
+		}
+
+		if atomic.LoadInt32(&adapter.maintenance) == 1 {
+			// Acknowledge the webhook so LINE does not retry, and let the users know why the bot does not respond.
+			go adapter.replyMaintenance(ctx, events)
+			if adapter.config.OnBatchResult != nil {
+				adapter.config.OnBatchResult(len(events), 0, 0)
+			}
+			return
+		}
+
+		eventCtx := handlerCtx
+		if len(adapter.config.PropagatedHeaders) > 0 {
+			headers := http.Header{}
+			for _, name := range adapter.config.PropagatedHeaders {
+				if value := req.Header.Get(name); value != "" {
+					headers.Set(name, value)
+				}
+			}
+			eventCtx = context.WithValue(eventCtx, headersContextKey, headers)
+		}
+
+		// Track the results of the whole webhook regardless of which event handler processes each event.
+		result, ok := req.Context().Value(batchResultContextKey).(*batchResult)
+		if !ok {
+			result = newBatchResult()
+		}
+		eventCtx = context.WithValue(eventCtx, batchResultContextKey, result)
+		adapter.handleEvents(eventCtx, events, result.track(enqueueInput))
+
+		if adapter.config.OnBatchResult != nil {
+			enqueued, failed := result.counts()
+			adapter.config.OnBatchResult(len(events), enqueued, failed)
+		}
 	})
-	handler.HandleError(func(err error, req *http.Request) {
-		dump, dumpErr := httputil.DumpRequest(req, true)
-		if dumpErr == nil {
-			log.Errorf("error on request parsing and/or signature validation. error: %s. request: %s.", err.Error(), dump)
+	handler.HandleError(adapter.requestErrorHandler)
+
+	if !adapter.config.SynchronousHandling {
+		return handler, nil
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The webhook handler responds with 200 by not writing anything after the events are handled,
+		// so an enqueue failure can still be responded with another status code here.
+		// LINE redelivers the whole webhook, so 503 is returned only when no input is enqueued; otherwise the enqueued ones would run twice.
+		result := newBatchResult()
+		handler.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), batchResultContextKey, result)))
+		if result.rejected() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}), nil
+}
+
+// batchResult tracks the results of the events within one webhook request for Config.OnBatchResult and Config.SynchronousHandling.
+type batchResult struct {
+	mutex sync.Mutex
+	errs  map[sarah.Input]error
+	// unkeyedEnqueued and unkeyedFailed count the inputs that can not be used as map keys and hence are not tracked by errs.
+	unkeyedEnqueued int
+	unkeyedFailed   int
+	// dropped is the number of events that are dropped before enqueueing because they can not be converted to inputs.
+	dropped int
+}
+
+func newBatchResult() *batchResult {
+	return &batchResult{
+		errs: map[sarah.Input]error{},
+	}
+}
+
+// track wraps given enqueueing function to record the result of each input.
+// An input is recorded with the result of the latest trial so an input that is enqueued on retry is not regarded as failed.
+func (r *batchResult) track(enqueueInput func(sarah.Input) error) func(sarah.Input) error {
+	return func(input sarah.Input) error {
+		err := enqueueInput(input)
+
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if !reflect.TypeOf(input).Comparable() {
+			if err != nil {
+				r.unkeyedFailed++
+			} else {
+				r.unkeyedEnqueued++
+			}
+			return err
+		}
+		r.errs[input] = err
+		return err
+	}
+}
+
+// drop records an event that is dropped before enqueueing.
+func (r *batchResult) drop() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.dropped++
+}
+
+// counts returns the number of enqueued inputs and the number of failed events.
+func (r *batchResult) counts() (int, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	enqueued := r.unkeyedEnqueued
+	failed := r.unkeyedFailed + r.dropped
+	for _, err := range r.errs {
+		if err != nil {
+			failed++
 		} else {
-			log.Errorf("error on request parsing and/or signature validation: %s.", err.Error())
+			enqueued++
 		}
-	})
+	}
+	return enqueued, failed
+}
+
+// rejected tells if some events failed and none of the inputs is enqueued.
+func (r *batchResult) rejected() bool {
+	enqueued, failed := r.counts()
+	return failed > 0 && enqueued == 0
+}
+
+// SetMaintenanceMode turns the maintenance mode on or off at runtime.
+// While in maintenance mode, webhook requests are still acknowledged, but no event is processed
+// and each message event is replied with Config.MaintenanceMessage instead.
+func (adapter *Adapter) SetMaintenanceMode(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&adapter.maintenance, value)
+}
+
+func (adapter *Adapter) replyMaintenance(ctx context.Context, events []*linebot.Event) {
+	message := linebot.NewTextMessage(adapter.config.MaintenanceMessage)
+	for _, event := range events {
+		if event.Type != linebot.EventTypeMessage || event.ReplyToken == "" {
+			continue
+		}
+
+		err := adapter.reply(ctx, event.ReplyToken, []linebot.SendingMessage{message})
+		if err != nil {
+			log.Errorf("error on maintenance message reply: %s", err.Error())
+		}
+	}
+}
+
+// handleEvents passes given events to the event handler registered for each event's source type via WithSourceEventHandler,
+// and the rest to the default event handler.
+func (adapter *Adapter) handleEvents(ctx context.Context, events []*linebot.Event, enqueueInput func(sarah.Input) error) {
+	if len(adapter.sourceEventHandlers) == 0 {
+		adapter.eventHandler(ctx, adapter.config, events, enqueueInput)
+		return
+	}
+
+	var rest []*linebot.Event
+	grouped := map[linebot.EventSourceType][]*linebot.Event{}
+	var sourceTypes []linebot.EventSourceType
+	for _, event := range events {
+		if event.Source != nil {
+			if _, ok := adapter.sourceEventHandlers[event.Source.Type]; ok {
+				if _, seen := grouped[event.Source.Type]; !seen {
+					sourceTypes = append(sourceTypes, event.Source.Type)
+				}
+				grouped[event.Source.Type] = append(grouped[event.Source.Type], event)
+				continue
+			}
+		}
+		rest = append(rest, event)
+	}
+
+	for _, sourceType := range sourceTypes {
+		adapter.sourceEventHandlers[sourceType](ctx, adapter.config, grouped[sourceType], enqueueInput)
+	}
+	if len(rest) > 0 {
+		adapter.eventHandler(ctx, adapter.config, rest, enqueueInput)
+	}
+}
+
+func (adapter *Adapter) listen(ctx context.Context, enqueueInput func(sarah.Input) error) error {
+	handler, err := adapter.Handler(ctx, enqueueInput)
+	if err != nil {
+		return err
+	}
 
 	adapter.mux.Handle(adapter.config.Endpoint, handler)
+	if prefix := strings.TrimSuffix(adapter.config.PathPrefix, "/"); prefix != "" {
+		// Accept the request whether or not the ingress strips the prefix, so the same binary works in both deployments.
+		adapter.mux.Handle(prefix+adapter.config.Endpoint, handler)
+	}
+	if adapter.contentHost != nil {
+		adapter.mux.Handle(strings.TrimSuffix(adapter.config.TemporaryContentPath, "/")+"/", adapter.contentHost)
+	}
 	addr := fmt.Sprintf(":%d", adapter.config.Port)
 	if adapter.config.TLS == nil {
 		return http.ListenAndServe(addr, adapter.mux)
@@ -200,18 +899,98 @@ func (adapter *Adapter) listen(ctx context.Context, enqueueInput func(sarah.Inpu
 	return http.ListenAndServeTLS(addr, adapter.config.TLS.CertFile, adapter.config.TLS.KeyFile, adapter.mux)
 }
 
-func defaultEventHandler(_ context.Context, config *Config, events []*linebot.Event, enqueueInput func(sarah.Input) error) {
+func defaultRequestErrorHandler(err error, req *http.Request) {
+	dump, dumpErr := httputil.DumpRequest(req, true)
+	if dumpErr == nil {
+		log.Errorf("error on request parsing and/or signature validation. error: %s. request: %s.", err.Error(), dump)
+	} else {
+		log.Errorf("error on request parsing and/or signature validation: %s.", err.Error())
+	}
+}
+
+func defaultEventHandler(ctx context.Context, config *Config, events []*linebot.Event, enqueueInput func(sarah.Input) error) {
+	headers, _ := ctx.Value(headersContextKey).(http.Header)
+	result, _ := ctx.Value(batchResultContextKey).(*batchResult)
 	for _, event := range events {
-		if event.Type == linebot.EventTypeMessage || event.Type == linebot.EventTypePostback {
-			input, err := EventToUserInput(config, event)
-			if err != nil {
-				log.Errorf("Error on event handling: %s.", err.Error())
-				continue
-			}
+		if event.Type != linebot.EventTypeMessage && event.Type != linebot.EventTypePostback {
+			continue
+		}
+
+		err := handleUserEvent(config, event, headers, enqueueInput)
+		if err == errEventConversion && result != nil {
+			result.drop()
+		}
+	}
+}
+
+// errEventConversion is returned by handleUserEvent when the event can not be converted to sarah.Input.
+var errEventConversion = errors.New("event can not be converted to input")
+
+// handleUserEvent converts given message or postback event to sarah.Input and enqueues it.
+// errEventConversion is returned when the event can not be converted, and the enqueueing error is returned as-is.
+// nil is returned when the input is enqueued or the event is intentionally skipped.
+func handleUserEvent(config *Config, event *linebot.Event, headers http.Header, enqueueInput func(sarah.Input) error) error {
+	input, err := eventToUserInput(config, event, headers)
+	if err != nil {
+		log.Errorf("Error on event handling: %s.", err.Error())
+		return errEventConversion
+	}
+
+	// Reject old events to prevent captured webhook payloads from being replayed.
+	if config.MaxEventAge > 0 && time.Since(input.SentAt()) > config.MaxEventAge {
+		log.Warnf("Skipping event that is older than %s. Timestamp: %s.", config.MaxEventAge, input.SentAt())
+		return nil
+	}
+
+	err = enqueue(config, input, enqueueInput)
+	if err != nil {
+		log.Errorf("Failed to enqueue input. Input is dropped: %s.", err.Error())
+		return err
+	}
+
+	return nil
+}
+
+// enqueue passes given input to enqueueInput.
+// When sarah's input queue is full, this retries with Config.EnqueueRetryPolicy so a temporary traffic spike does not drop user messages.
+// When Config.EventHandlerTimeout is positive, this gives up and drops the input instead of waiting for the next trial beyond the timeout,
+// so one blocked input does not hold the webhook response long enough for LINE to treat the webhook as failing.
+func enqueue(config *Config, input sarah.Input, enqueueInput func(sarah.Input) error) error {
+	err := enqueueInput(input)
+	policy := config.EnqueueRetryPolicy
+	if _, ok := err.(*sarah.BlockedInputError); !ok || policy == nil {
+		return err
+	}
 
-			enqueueInput(input)
+	var deadline time.Time
+	if config.EventHandlerTimeout > 0 {
+		deadline = time.Now().Add(config.EventHandlerTimeout)
+	}
+
+	for trial := uint(1); trial < policy.Trial; trial++ {
+		interval := retryInterval(policy)
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("input is not enqueued within %s: %s", config.EventHandlerTimeout, err.Error())
+		}
+		time.Sleep(interval)
+
+		err = enqueueInput(input)
+		if _, ok := err.(*sarah.BlockedInputError); !ok {
+			return err
 		}
 	}
+
+	return err
+}
+
+// retryInterval returns the interval before the next trial, randomized with the policy's RandFactor in the same way as retry.WithPolicy.
+func retryInterval(policy *retry.Policy) time.Duration {
+	if policy.RandFactor <= 0 || policy.Interval <= 0 {
+		return policy.Interval
+	}
+
+	delta := math.Min(policy.RandFactor, 1) * float64(policy.Interval)
+	return time.Duration(float64(policy.Interval) - delta + rand.Float64()*2*delta)
 }
 
 // EventToUserInput converts linebot.Event to a corresponding struct that implements sarah.Input.
@@ -219,23 +998,47 @@ func defaultEventHandler(_ context.Context, config *Config, events []*linebot.Ev
 // This does not treat Follow, Unfollow, Join, Leave, or Beacon as *user input*.
 // It is nonsense to pass uniformed state change event to sarah.Commands and find corresponding sarah.Command.
 // To handle those events, pass customized event handler on Adapter construction via WithEventHandler.
+//
+// The returned input does not carry any webhook request header; Config.PropagatedHeaders is only applied by the default event handler.
 func EventToUserInput(config *Config, event *linebot.Event) (sarah.Input, error) {
+	return eventToUserInput(config, event, nil)
+}
+
+// eventToUserInput converts linebot.Event to sarah.Input just like EventToUserInput, and attaches given webhook request headers to the input.
+func eventToUserInput(config *Config, event *linebot.Event, headers http.Header) (sarah.Input, error) {
+	if event.Source == nil {
+		return nil, ErrUnrecognizedEventSource
+	}
+
 	sourceType := event.Source.Type
 	senderKey, err := SourceToSenderKey(event.Source)
 	if err != nil {
 		return nil, err
 	}
+	conversationID, err := SourceToConversationID(event.Source)
+	if err != nil {
+		return nil, err
+	}
 
 	if event.Type == linebot.EventTypeMessage {
 		switch message := event.Message.(type) {
 		case *linebot.TextMessage:
+			text := message.Text
+			if config.StripPrefix != "" {
+				// Help and abort commands are still compared against the original text below.
+				text = strings.TrimPrefix(text, config.StripPrefix)
+			}
 			input := &TextInput{
-				sourceType: sourceType,
-				ID:         message.ID,
-				senderKey:  senderKey,
-				text:       message.Text,
-				replyToken: event.ReplyToken,
-				timestamp:  event.Timestamp,
+				sourceType:         sourceType,
+				ID:                 message.ID,
+				senderKey:          senderKey,
+				conversationID:     conversationID,
+				text:               text,
+				replyToken:         event.ReplyToken,
+				timestamp:          event.Timestamp,
+				headers:            headers,
+				source:             event.Source,
+				replyTokenLifetime: config.ReplyTokenLifetime,
 			}
 
 			trimmed := strings.TrimSpace(message.Text)
@@ -253,32 +1056,44 @@ func EventToUserInput(config *Config, event *linebot.Event) (sarah.Input, error)
 
 		case *linebot.ImageMessage:
 			return &FileInput{
-				sourceType: sourceType,
-				Type:       linebot.MessageTypeImage,
-				ID:         message.ID,
-				senderKey:  senderKey,
-				replyToken: event.ReplyToken,
-				timestamp:  event.Timestamp,
+				sourceType:         sourceType,
+				Type:               linebot.MessageTypeImage,
+				ID:                 message.ID,
+				senderKey:          senderKey,
+				conversationID:     conversationID,
+				replyToken:         event.ReplyToken,
+				timestamp:          event.Timestamp,
+				headers:            headers,
+				source:             event.Source,
+				replyTokenLifetime: config.ReplyTokenLifetime,
 			}, nil
 
 		case *linebot.VideoMessage:
 			return &FileInput{
-				sourceType: sourceType,
-				Type:       linebot.MessageTypeVideo,
-				ID:         message.ID,
-				senderKey:  senderKey,
-				replyToken: event.ReplyToken,
-				timestamp:  event.Timestamp,
+				sourceType:         sourceType,
+				Type:               linebot.MessageTypeVideo,
+				ID:                 message.ID,
+				senderKey:          senderKey,
+				conversationID:     conversationID,
+				replyToken:         event.ReplyToken,
+				timestamp:          event.Timestamp,
+				headers:            headers,
+				source:             event.Source,
+				replyTokenLifetime: config.ReplyTokenLifetime,
 			}, nil
 
 		case *linebot.AudioMessage:
 			return &FileInput{
-				sourceType: sourceType,
-				Type:       linebot.MessageTypeAudio,
-				ID:         message.ID,
-				senderKey:  senderKey,
-				replyToken: event.ReplyToken,
-				timestamp:  event.Timestamp,
+				sourceType:         sourceType,
+				Type:               linebot.MessageTypeAudio,
+				ID:                 message.ID,
+				senderKey:          senderKey,
+				conversationID:     conversationID,
+				replyToken:         event.ReplyToken,
+				timestamp:          event.Timestamp,
+				headers:            headers,
+				source:             event.Source,
+				replyTokenLifetime: config.ReplyTokenLifetime,
 			}, nil
 
 		case *linebot.LocationMessage:
@@ -291,9 +1106,13 @@ func EventToUserInput(config *Config, event *linebot.Event) (sarah.Input, error)
 					Latitude:  message.Latitude,
 					Longitude: message.Longitude,
 				},
-				senderKey:  senderKey,
-				replyToken: event.ReplyToken,
-				timestamp:  event.Timestamp,
+				senderKey:          senderKey,
+				conversationID:     conversationID,
+				replyToken:         event.ReplyToken,
+				timestamp:          event.Timestamp,
+				headers:            headers,
+				source:             event.Source,
+				replyTokenLifetime: config.ReplyTokenLifetime,
 			}, nil
 
 		case *linebot.StickerMessage:
@@ -304,9 +1123,15 @@ func EventToUserInput(config *Config, event *linebot.Event) (sarah.Input, error)
 				PackageID: message.PackageID,
 				StickerID: message.StickerID,
 
-				senderKey:  senderKey,
-				replyToken: event.ReplyToken,
-				timestamp:  event.Timestamp,
+				text: config.StickerKeywords[message.PackageID+"/"+message.StickerID],
+
+				senderKey:          senderKey,
+				conversationID:     conversationID,
+				replyToken:         event.ReplyToken,
+				timestamp:          event.Timestamp,
+				headers:            headers,
+				source:             event.Source,
+				replyTokenLifetime: config.ReplyTokenLifetime,
 			}, nil
 
 		default:
@@ -324,12 +1149,16 @@ func EventToUserInput(config *Config, event *linebot.Event) (sarah.Input, error)
 			}
 		}
 		input := &PostbackEvent{
-			Params:     params,
-			sourceType: sourceType,
-			senderKey:  senderKey,
-			data:       postback.Data,
-			replyToken: event.ReplyToken,
-			timestamp:  event.Timestamp,
+			Params:             params,
+			sourceType:         sourceType,
+			senderKey:          senderKey,
+			conversationID:     conversationID,
+			data:               postback.Data,
+			replyToken:         event.ReplyToken,
+			timestamp:          event.Timestamp,
+			headers:            headers,
+			source:             event.Source,
+			replyTokenLifetime: config.ReplyTokenLifetime,
 		}
 
 		trimmed := strings.TrimSpace(input.Message())
@@ -355,6 +1184,10 @@ var ErrUnrecognizedEventSource = errors.New("unrecognized event source type is g
 // SourceToSenderKey generates unique sender key from given event.
 // https://devdocs.line.me/en/#webhook-event-object
 func SourceToSenderKey(s *linebot.EventSource) (string, error) {
+	if s == nil {
+		return "", ErrUnrecognizedEventSource
+	}
+
 	switch s.Type {
 	case linebot.EventSourceTypeUser:
 		return fmt.Sprintf("user|%s", s.UserID), nil
@@ -371,15 +1204,47 @@ func SourceToSenderKey(s *linebot.EventSource) (string, error) {
 	}
 }
 
+// SourceToConversationID returns the ID of the user, room, or group that the given event is sent from.
+// This can be used as a destination of push message to continue the conversation without depending on the single-use reply token.
+func SourceToConversationID(s *linebot.EventSource) (string, error) {
+	if s == nil {
+		return "", ErrUnrecognizedEventSource
+	}
+
+	switch s.Type {
+	case linebot.EventSourceTypeUser:
+		return s.UserID, nil
+
+	case linebot.EventSourceTypeRoom:
+		return s.RoomID, nil
+
+	case linebot.EventSourceTypeGroup:
+		return s.GroupID, nil
+
+	default:
+		return "", ErrUnrecognizedEventSource
+
+	}
+}
+
 // TextInput represents text message sent from LINE.
 type TextInput struct {
 	ID string
 
-	sourceType linebot.EventSourceType
-	senderKey  string
-	text       string
-	replyToken string
-	timestamp  time.Time
+	sourceType         linebot.EventSourceType
+	senderKey          string
+	conversationID     string
+	text               string
+	replyToken         string
+	timestamp          time.Time
+	headers            http.Header
+	replyTokenLifetime time.Duration
+	source             *linebot.EventSource
+}
+
+// MessageID returns the ID of the sent message.
+func (input *TextInput) MessageID() string {
+	return input.ID
 }
 
 // SenderKey returns string representing message sender.
@@ -402,22 +1267,61 @@ func (input *TextInput) ReplyTo() sarah.OutputDestination {
 	return input.replyToken
 }
 
+// ReplyTokenExpired tells if the reply token is considered expired based on the event's timestamp and Config.ReplyTokenLifetime.
+// When this returns true, push the response to ConversationID instead of replying since the reply would fail.
+// This always returns false when Config.ReplyTokenLifetime is zero.
+func (input *TextInput) ReplyTokenExpired() bool {
+	return input.replyTokenLifetime > 0 && time.Since(input.timestamp) > input.replyTokenLifetime
+}
+
 // SourceType returns this event's linebot.EventSourceType.
 // All events in LINE Adapter implement SourceTyper, so this is safe to apply type assertion against sarah.Input and see corresponding source type.
 func (input *TextInput) SourceType() linebot.EventSourceType {
 	return input.sourceType
 }
 
+// Source returns the linebot.EventSource of this event as parsed by the SDK.
+// In a group or room, this also carries the ID of the user who sent the event when available.
+func (input *TextInput) Source() *linebot.EventSource {
+	return input.source
+}
+
+// ConversationID returns the ID of the user, room, or group this event is sent from.
+// This is safe to pass as a push message destination even after the reply token is consumed or expired.
+func (input *TextInput) ConversationID() string {
+	return input.conversationID
+}
+
+// EventType returns linebot.EventTypeMessage since this input is converted from message event.
+func (input *TextInput) EventType() linebot.EventType {
+	return linebot.EventTypeMessage
+}
+
+// Header returns the value of given webhook request header.
+// Only the headers listed in Config.PropagatedHeaders are kept; an empty string is returned for any other header.
+func (input *TextInput) Header(name string) string {
+	return input.headers.Get(name)
+}
+
 // FileInput represents file message sent from LINE.
 type FileInput struct {
 	// Type is one of MessageTypeImage, MessageTypeVideo, MessageTypeAudio
 	Type linebot.MessageType
 	ID   string
 
-	sourceType linebot.EventSourceType
-	senderKey  string
-	replyToken string
-	timestamp  time.Time
+	sourceType         linebot.EventSourceType
+	senderKey          string
+	conversationID     string
+	replyToken         string
+	timestamp          time.Time
+	headers            http.Header
+	replyTokenLifetime time.Duration
+	source             *linebot.EventSource
+}
+
+// MessageID returns the ID of the sent message.
+func (input *FileInput) MessageID() string {
+	return input.ID
 }
 
 // SenderKey returns string representing message sender.
@@ -440,12 +1344,42 @@ func (input *FileInput) ReplyTo() sarah.OutputDestination {
 	return input.replyToken
 }
 
+// ReplyTokenExpired tells if the reply token is considered expired based on the event's timestamp and Config.ReplyTokenLifetime.
+// When this returns true, push the response to ConversationID instead of replying since the reply would fail.
+// This always returns false when Config.ReplyTokenLifetime is zero.
+func (input *FileInput) ReplyTokenExpired() bool {
+	return input.replyTokenLifetime > 0 && time.Since(input.timestamp) > input.replyTokenLifetime
+}
+
 // SourceType returns this event's linebot.EventSourceType.
 // All events in LINE Adapter implement SourceTyper, so this is safe to apply type assertion against sarah.Input and see corresponding source type.
 func (input *FileInput) SourceType() linebot.EventSourceType {
 	return input.sourceType
 }
 
+// Source returns the linebot.EventSource of this event as parsed by the SDK.
+// In a group or room, this also carries the ID of the user who sent the event when available.
+func (input *FileInput) Source() *linebot.EventSource {
+	return input.source
+}
+
+// ConversationID returns the ID of the user, room, or group this event is sent from.
+// This is safe to pass as a push message destination even after the reply token is consumed or expired.
+func (input *FileInput) ConversationID() string {
+	return input.conversationID
+}
+
+// EventType returns linebot.EventTypeMessage since this input is converted from message event.
+func (input *FileInput) EventType() linebot.EventType {
+	return linebot.EventTypeMessage
+}
+
+// Header returns the value of given webhook request header.
+// Only the headers listed in Config.PropagatedHeaders are kept; an empty string is returned for any other header.
+func (input *FileInput) Header(name string) string {
+	return input.headers.Get(name)
+}
+
 // Location represents location being sent.
 type Location struct {
 	Title     string
@@ -459,10 +1393,19 @@ type LocationInput struct {
 	ID       string
 	Location *Location
 
-	sourceType linebot.EventSourceType
-	senderKey  string
-	replyToken string
-	timestamp  time.Time
+	sourceType         linebot.EventSourceType
+	senderKey          string
+	conversationID     string
+	replyToken         string
+	timestamp          time.Time
+	headers            http.Header
+	replyTokenLifetime time.Duration
+	source             *linebot.EventSource
+}
+
+// MessageID returns the ID of the sent message.
+func (input *LocationInput) MessageID() string {
+	return input.ID
 }
 
 // SenderKey returns string representing message sender.
@@ -485,22 +1428,62 @@ func (input *LocationInput) ReplyTo() sarah.OutputDestination {
 	return input.replyToken
 }
 
+// ReplyTokenExpired tells if the reply token is considered expired based on the event's timestamp and Config.ReplyTokenLifetime.
+// When this returns true, push the response to ConversationID instead of replying since the reply would fail.
+// This always returns false when Config.ReplyTokenLifetime is zero.
+func (input *LocationInput) ReplyTokenExpired() bool {
+	return input.replyTokenLifetime > 0 && time.Since(input.timestamp) > input.replyTokenLifetime
+}
+
 // SourceType returns this event's linebot.EventSourceType.
 // All events in LINE Adapter implement SourceTyper, so this is safe to apply type assertion against sarah.Input and see corresponding source type.
 func (input *LocationInput) SourceType() linebot.EventSourceType {
 	return input.sourceType
 }
 
+// Source returns the linebot.EventSource of this event as parsed by the SDK.
+// In a group or room, this also carries the ID of the user who sent the event when available.
+func (input *LocationInput) Source() *linebot.EventSource {
+	return input.source
+}
+
+// ConversationID returns the ID of the user, room, or group this event is sent from.
+// This is safe to pass as a push message destination even after the reply token is consumed or expired.
+func (input *LocationInput) ConversationID() string {
+	return input.conversationID
+}
+
+// EventType returns linebot.EventTypeMessage since this input is converted from message event.
+func (input *LocationInput) EventType() linebot.EventType {
+	return linebot.EventTypeMessage
+}
+
+// Header returns the value of given webhook request header.
+// Only the headers listed in Config.PropagatedHeaders are kept; an empty string is returned for any other header.
+func (input *LocationInput) Header(name string) string {
+	return input.headers.Get(name)
+}
+
 // StickerInput represents sticker message sent from LINE.
 type StickerInput struct {
 	ID        string
 	PackageID string
 	StickerID string
 
-	sourceType linebot.EventSourceType
-	senderKey  string
-	replyToken string
-	timestamp  time.Time
+	text               string
+	sourceType         linebot.EventSourceType
+	senderKey          string
+	conversationID     string
+	replyToken         string
+	timestamp          time.Time
+	headers            http.Header
+	replyTokenLifetime time.Duration
+	source             *linebot.EventSource
+}
+
+// MessageID returns the ID of the sent message.
+func (input *StickerInput) MessageID() string {
+	return input.ID
 }
 
 // SenderKey returns string representing message sender.
@@ -508,9 +1491,10 @@ func (input *StickerInput) SenderKey() string {
 	return input.senderKey
 }
 
-// Message returns sent message, which is empty in this case.
+// Message returns the phrase mapped to this sticker in Config.StickerKeywords, keyed as "packageID/stickerID."
+// This is empty when no phrase is mapped, since a sticker itself carries no text.
 func (input *StickerInput) Message() string {
-	return ""
+	return input.text
 }
 
 // SentAt returns message event's timestamp.
@@ -523,12 +1507,42 @@ func (input *StickerInput) ReplyTo() sarah.OutputDestination {
 	return input.replyToken
 }
 
+// ReplyTokenExpired tells if the reply token is considered expired based on the event's timestamp and Config.ReplyTokenLifetime.
+// When this returns true, push the response to ConversationID instead of replying since the reply would fail.
+// This always returns false when Config.ReplyTokenLifetime is zero.
+func (input *StickerInput) ReplyTokenExpired() bool {
+	return input.replyTokenLifetime > 0 && time.Since(input.timestamp) > input.replyTokenLifetime
+}
+
 // SourceType returns this event's linebot.EventSourceType.
 // All events in LINE Adapter implement SourceTyper, so this is safe to apply type assertion against sarah.Input and see corresponding source type.
 func (input *StickerInput) SourceType() linebot.EventSourceType {
 	return input.sourceType
 }
 
+// Source returns the linebot.EventSource of this event as parsed by the SDK.
+// In a group or room, this also carries the ID of the user who sent the event when available.
+func (input *StickerInput) Source() *linebot.EventSource {
+	return input.source
+}
+
+// ConversationID returns the ID of the user, room, or group this event is sent from.
+// This is safe to pass as a push message destination even after the reply token is consumed or expired.
+func (input *StickerInput) ConversationID() string {
+	return input.conversationID
+}
+
+// EventType returns linebot.EventTypeMessage since this input is converted from message event.
+func (input *StickerInput) EventType() linebot.EventType {
+	return linebot.EventTypeMessage
+}
+
+// Header returns the value of given webhook request header.
+// Only the headers listed in Config.PropagatedHeaders are kept; an empty string is returned for any other header.
+func (input *StickerInput) Header(name string) string {
+	return input.headers.Get(name)
+}
+
 // PostbackParams includes some datetime related parameters set by user.
 // This is set when and only when user picks datetime via datetime picker action.
 //
@@ -539,15 +1553,26 @@ type PostbackParams struct {
 	Datetime string
 }
 
+// Layouts of the values in PostbackParams.
+const (
+	postbackDateLayout     = "2006-01-02"
+	postbackTimeLayout     = "15:04"
+	postbackDatetimeLayout = "2006-01-02T15:04"
+)
+
 // PostbackEvent represents postback event sent from LINE.
 type PostbackEvent struct {
 	Params *PostbackParams
 
-	sourceType linebot.EventSourceType
-	senderKey  string
-	data       string
-	replyToken string
-	timestamp  time.Time
+	sourceType         linebot.EventSourceType
+	senderKey          string
+	conversationID     string
+	data               string
+	replyToken         string
+	timestamp          time.Time
+	headers            http.Header
+	replyTokenLifetime time.Duration
+	source             *linebot.EventSource
 }
 
 // SenderKey returns string representing message sender.
@@ -560,6 +1585,40 @@ func (input *PostbackEvent) Message() string {
 	return input.data
 }
 
+// DatetimePicked returns the date and/or time the user picked via datetime picker action.
+// This returns false when the postback is not triggered by datetime picker action.
+// Message returns the action's data as usual, so the picked value and the action context can be referred together.
+//
+// LINE does not tell the user's time zone, so the returned value is in UTC.
+// When the action's mode is "time", the date part is zero; when the mode is "date", the time part is zero.
+func (input *PostbackEvent) DatetimePicked() (time.Time, bool) {
+	if input.Params == nil {
+		return time.Time{}, false
+	}
+
+	var picked time.Time
+	var err error
+	switch {
+	case input.Params.Datetime != "":
+		picked, err = time.Parse(postbackDatetimeLayout, input.Params.Datetime)
+
+	case input.Params.Date != "":
+		picked, err = time.Parse(postbackDateLayout, input.Params.Date)
+
+	case input.Params.Time != "":
+		picked, err = time.Parse(postbackTimeLayout, input.Params.Time)
+
+	default:
+		return time.Time{}, false
+
+	}
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return picked, true
+}
+
 // SentAt returns message event's timestamp.
 func (input *PostbackEvent) SentAt() time.Time {
 	return input.timestamp
@@ -570,23 +1629,115 @@ func (input *PostbackEvent) ReplyTo() sarah.OutputDestination {
 	return input.replyToken
 }
 
+// ReplyTokenExpired tells if the reply token is considered expired based on the event's timestamp and Config.ReplyTokenLifetime.
+// When this returns true, push the response to ConversationID instead of replying since the reply would fail.
+// This always returns false when Config.ReplyTokenLifetime is zero.
+func (input *PostbackEvent) ReplyTokenExpired() bool {
+	return input.replyTokenLifetime > 0 && time.Since(input.timestamp) > input.replyTokenLifetime
+}
+
 // SourceType returns this event's linebot.EventSourceType.
 // All events in LINE Adapter implement SourceTyper, so this is safe to apply type assertion against sarah.Input and see corresponding source type.
 func (input *PostbackEvent) SourceType() linebot.EventSourceType {
 	return input.sourceType
 }
 
+// Source returns the linebot.EventSource of this event as parsed by the SDK.
+// In a group or room, this also carries the ID of the user who sent the event when available.
+func (input *PostbackEvent) Source() *linebot.EventSource {
+	return input.source
+}
+
+// ConversationID returns the ID of the user, room, or group this event is sent from.
+// This is safe to pass as a push message destination even after the reply token is consumed or expired.
+func (input *PostbackEvent) ConversationID() string {
+	return input.conversationID
+}
+
+// EventType returns linebot.EventTypePostback since this input is converted from postback event.
+func (input *PostbackEvent) EventType() linebot.EventType {
+	return linebot.EventTypePostback
+}
+
+// Header returns the value of given webhook request header.
+// Only the headers listed in Config.PropagatedHeaders are kept; an empty string is returned for any other header.
+func (input *PostbackEvent) Header(name string) string {
+	return input.headers.Get(name)
+}
+
 // SourceTyper is an interface that returns event's linebot.EventSourceType
 type SourceTyper interface {
 	SourceType() linebot.EventSourceType
 }
 
-// Make sure All input types implements SourceTyper and sarah.Input
+// MessageIDer is an interface that returns the ID of the sent message.
+// This is implemented by inputs that derive from message events, but not by PostbackEvent since a postback does not carry any message.
+type MessageIDer interface {
+	MessageID() string
+}
+
+// Sourcer is an interface that returns the linebot.EventSource of the event an input is converted from.
+type Sourcer interface {
+	Source() *linebot.EventSource
+}
+
+// EventTyper is an interface that returns the linebot.EventType of the event an input is converted from.
+// This lets a generic pipeline branch on the event type without type switches against concrete input types.
+type EventTyper interface {
+	EventType() linebot.EventType
+}
+
+// ReplyTokenExpirer is an interface that tells if the reply token of an input is considered expired.
+type ReplyTokenExpirer interface {
+	ReplyTokenExpired() bool
+}
+
+// Headerer is an interface that returns the value of a webhook request header the input is delivered with.
+// Only the headers listed in Config.PropagatedHeaders are available, which is handy to correlate an input with the originating trace.
+type Headerer interface {
+	Header(name string) string
+}
+
+// ConversationIDer is an interface that returns the ID of the user, room, or group an event is sent from.
+type ConversationIDer interface {
+	ConversationID() string
+}
+
+// Make sure All input types implements SourceTyper, Sourcer, EventTyper, ReplyTokenExpirer, Headerer, ConversationIDer and sarah.Input
 var _ SourceTyper = (*TextInput)(nil)
 var _ SourceTyper = (*FileInput)(nil)
 var _ SourceTyper = (*StickerInput)(nil)
 var _ SourceTyper = (*LocationInput)(nil)
 var _ SourceTyper = (*PostbackEvent)(nil)
+var _ Sourcer = (*TextInput)(nil)
+var _ Sourcer = (*FileInput)(nil)
+var _ Sourcer = (*StickerInput)(nil)
+var _ Sourcer = (*LocationInput)(nil)
+var _ Sourcer = (*PostbackEvent)(nil)
+var _ EventTyper = (*TextInput)(nil)
+var _ EventTyper = (*FileInput)(nil)
+var _ EventTyper = (*StickerInput)(nil)
+var _ EventTyper = (*LocationInput)(nil)
+var _ EventTyper = (*PostbackEvent)(nil)
+var _ ReplyTokenExpirer = (*TextInput)(nil)
+var _ ReplyTokenExpirer = (*FileInput)(nil)
+var _ ReplyTokenExpirer = (*StickerInput)(nil)
+var _ ReplyTokenExpirer = (*LocationInput)(nil)
+var _ ReplyTokenExpirer = (*PostbackEvent)(nil)
+var _ Headerer = (*TextInput)(nil)
+var _ Headerer = (*FileInput)(nil)
+var _ Headerer = (*StickerInput)(nil)
+var _ Headerer = (*LocationInput)(nil)
+var _ Headerer = (*PostbackEvent)(nil)
+var _ ConversationIDer = (*TextInput)(nil)
+var _ ConversationIDer = (*FileInput)(nil)
+var _ ConversationIDer = (*StickerInput)(nil)
+var _ ConversationIDer = (*LocationInput)(nil)
+var _ ConversationIDer = (*PostbackEvent)(nil)
+var _ MessageIDer = (*TextInput)(nil)
+var _ MessageIDer = (*FileInput)(nil)
+var _ MessageIDer = (*StickerInput)(nil)
+var _ MessageIDer = (*LocationInput)(nil)
 var _ sarah.Input = (*TextInput)(nil)
 var _ sarah.Input = (*FileInput)(nil)
 var _ sarah.Input = (*StickerInput)(nil)
@@ -623,6 +1774,36 @@ func IsSourceGroup(input interface{}) bool {
 	return typer.SourceType() == linebot.EventSourceTypeGroup
 }
 
+// IsTextInput checks given input and return true if the given input is text message.
+func IsTextInput(input interface{}) bool {
+	_, ok := input.(*TextInput)
+	return ok
+}
+
+// IsFileInput checks given input and return true if the given input is file message such as image, video, or audio.
+func IsFileInput(input interface{}) bool {
+	_, ok := input.(*FileInput)
+	return ok
+}
+
+// IsLocationInput checks given input and return true if the given input is location message.
+func IsLocationInput(input interface{}) bool {
+	_, ok := input.(*LocationInput)
+	return ok
+}
+
+// IsStickerInput checks given input and return true if the given input is sticker message.
+func IsStickerInput(input interface{}) bool {
+	_, ok := input.(*StickerInput)
+	return ok
+}
+
+// IsPostbackEvent checks given input and return true if the given input is postback event.
+func IsPostbackEvent(input interface{}) bool {
+	_, ok := input.(*PostbackEvent)
+	return ok
+}
+
 // NewStringResponse creates new sarah.CommandResponse instance with given string.
 func NewStringResponse(responseContent string) *sarah.CommandResponse {
 	return &sarah.CommandResponse{
@@ -631,6 +1812,25 @@ func NewStringResponse(responseContent string) *sarah.CommandResponse {
 	}
 }
 
+// NewStringResponseEndingContext creates new sarah.CommandResponse instance with given string and no next function.
+// This is identical to NewStringResponse, but explicitly tells the reader that the user's conversational context ends with this response.
+func NewStringResponseEndingContext(responseContent string) *sarah.CommandResponse {
+	return &sarah.CommandResponse{
+		Content:     linebot.NewTextMessage(responseContent),
+		UserContext: nil, // No further UserContext is stored, so the conversation ends here.
+	}
+}
+
+// NewLocationRequestResponse creates new sarah.CommandResponse instance with given string and a quick reply button that prompts the user to share the location.
+// label is shown on the quick reply button.
+func NewLocationRequestResponse(responseContent string, label string) *sarah.CommandResponse {
+	items := linebot.NewQuickReplyItems(linebot.NewQuickReplyButton("", linebot.NewLocationAction(label)))
+	return &sarah.CommandResponse{
+		Content:     linebot.NewTextMessage(responseContent).WithQuickReplies(items),
+		UserContext: nil,
+	}
+}
+
 // NewStringResponseWithNext creates new sarah.CommandResponse instance with given string and next function to continue.
 func NewStringResponseWithNext(responseContent string, next sarah.ContextualFunc) *sarah.CommandResponse {
 	return NewCustomizedResponseWithNext(linebot.NewTextMessage(responseContent), next)
@@ -667,3 +1867,59 @@ func NewMultipleCustomizedResponsesWithNext(responseMessages []linebot.Message,
 		UserContext: sarah.NewUserContext(next),
 	}
 }
+
+// DeferredContent represents a content that immediately replies with an interim message and later pushes the result of a time-consuming task.
+// Since a reply token is single-use, the result is pushed to ConversationID instead.
+type DeferredContent struct {
+	Interim        linebot.SendingMessage
+	ConversationID string
+	Task           func(context.Context) ([]linebot.SendingMessage, error)
+}
+
+// NewDeferredResponse creates new sarah.CommandResponse instance that replies with given interim string and then pushes the messages returned by given task.
+// The task is executed in a separate goroutine after the interim message is sent, so a long-running command does not leave the user without any feedback.
+//
+//	func(ctx context.Context, input sarah.Input) (*sarah.CommandResponse, error) {
+//	  return line.NewDeferredResponse(input, "Working on it...", func(ctx context.Context) ([]linebot.SendingMessage, error) {
+//	    result, err := doSomethingHeavy()
+//	    if err != nil {
+//	      return nil, err
+//	    }
+//	    return []linebot.SendingMessage{linebot.NewTextMessage(result)}, nil
+//	  })
+//	}
+//
+// An error is returned when the conversation ID can not be obtained from given input.
+func NewDeferredResponse(input sarah.Input, interim string, task func(context.Context) ([]linebot.SendingMessage, error)) (*sarah.CommandResponse, error) {
+	ider, ok := input.(ConversationIDer)
+	if !ok {
+		return nil, fmt.Errorf("conversation ID can not be obtained from %T", input)
+	}
+
+	return &sarah.CommandResponse{
+		Content: &DeferredContent{
+			Interim:        linebot.NewTextMessage(interim),
+			ConversationID: ider.ConversationID(),
+			Task:           task,
+		},
+		UserContext: nil,
+	}, nil
+}
+
+// FallbackContent represents a rich message with a plain-text alternative for LINE clients that can not render the rich one.
+// The fallback text is sent right after the rich message only when Config.SendTextFallback is true.
+type FallbackContent struct {
+	Rich     linebot.SendingMessage
+	Fallback string
+}
+
+// NewRichWithTextFallback creates new sarah.CommandResponse instance with given rich message and its plain-text fallback.
+func NewRichWithTextFallback(rich linebot.SendingMessage, fallback string) *sarah.CommandResponse {
+	return &sarah.CommandResponse{
+		Content: &FallbackContent{
+			Rich:     rich,
+			Fallback: fallback,
+		},
+		UserContext: nil,
+	}
+}
@@ -0,0 +1,222 @@
+package line_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah-line"
+	"github.com/oklahomer/go-sarah-line/linetest"
+	"github.com/oklahomer/go-sarah/v2"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAdapter_Handler_MaxEventsPerRequest(t *testing.T) {
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+	config.MaxEventsPerRequest = 3
+
+	adapter, err := line.NewAdapter(config)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	// Craft a payload that claims more events than allowed.
+	var events []string
+	for i := 0; i < 10; i++ {
+		events = append(events, fmt.Sprintf(`{
+			"type": "message",
+			"replyToken": "token%d",
+			"timestamp": 1462629479859,
+			"source": {"type": "user", "userId": "U%d"},
+			"message": {"id": "%d", "type": "text", "text": "message %d"}
+		}`, i, i, i, i))
+	}
+	body := []byte(`{"events": [` + strings.Join(events, ",") + `]}`)
+
+	status, inputs := linetest.PostPayload(t, adapter, linetest.Sign(config.ChannelSecret, body), body)
+	if status != http.StatusOK {
+		t.Fatalf("Unexpected status code is returned: %d.", status)
+	}
+
+	if len(inputs) != config.MaxEventsPerRequest {
+		t.Fatalf("Expected %d inputs, but was %d.", config.MaxEventsPerRequest, len(inputs))
+	}
+
+	for i, input := range inputs {
+		expected := fmt.Sprintf("message %d", i)
+		if input.Message() != expected {
+			t.Errorf("Expected %q at index %d, but was %q.", expected, i, input.Message())
+		}
+	}
+}
+
+func TestAdapter_SendMessage_CommandHelps(t *testing.T) {
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+
+	adapter, err := line.NewAdapter(config, line.WithCaptureMode())
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	// More commands than the number of messages a reply can contain.
+	helps := &sarah.CommandHelps{}
+	for i := 0; i < 7; i++ {
+		*helps = append(*helps, &sarah.CommandHelp{
+			Identifier:  fmt.Sprintf("command%d", i),
+			Instruction: fmt.Sprintf(".command%d", i),
+		})
+	}
+
+	adapter.SendMessage(context.TODO(), sarah.NewOutputMessage("replyToken", helps))
+
+	sent := adapter.LastSent()
+	if len(sent) != 1 {
+		t.Fatalf("Expected 1 message, but was %d.", len(sent))
+	}
+
+	text, ok := sent[0].(*linebot.TextMessage)
+	if !ok {
+		t.Fatalf("Unexpected message type is sent: %T.", sent[0])
+	}
+	for _, help := range *helps {
+		if !strings.Contains(text.Text, help.Instruction) {
+			t.Errorf("Instruction %q is not included in %q.", help.Instruction, text.Text)
+		}
+	}
+}
+
+func TestAdapter_Handler_OnBatchResult(t *testing.T) {
+	type result struct {
+		total    int
+		enqueued int
+		failed   int
+	}
+	var results []*result
+
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+	config.OnBatchResult = func(total, enqueued, failed int) {
+		results = append(results, &result{total: total, enqueued: enqueued, failed: failed})
+	}
+
+	// Group events are handled by a source handler while the rest are handled by the default one.
+	groupHandler := func(_ context.Context, config *line.Config, events []*linebot.Event, enqueueInput func(sarah.Input) error) {
+		for _, event := range events {
+			input, err := line.EventToUserInput(config, event)
+			if err != nil {
+				t.Errorf("Unexpected error is returned: %s.", err.Error())
+				continue
+			}
+			_ = enqueueInput(input)
+		}
+	}
+	adapter, err := line.NewAdapter(config, line.WithSourceEventHandler(linebot.EventSourceTypeGroup, groupHandler))
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	var events []string
+	for i := 0; i < 5; i++ {
+		source := fmt.Sprintf(`{"type": "user", "userId": "U%d"}`, i)
+		if i%2 == 0 {
+			source = fmt.Sprintf(`{"type": "group", "groupId": "G", "userId": "U%d"}`, i)
+		}
+		events = append(events, fmt.Sprintf(`{
+			"type": "message",
+			"replyToken": "token%d",
+			"timestamp": 1462629479859,
+			"source": %s,
+			"message": {"id": "%d", "type": "text", "text": "message %d"}
+		}`, i, source, i, i))
+	}
+	body := []byte(`{"events": [` + strings.Join(events, ",") + `]}`)
+
+	status, inputs := linetest.PostPayload(t, adapter, linetest.Sign(config.ChannelSecret, body), body)
+	if status != http.StatusOK {
+		t.Fatalf("Unexpected status code is returned: %d.", status)
+	}
+	if len(inputs) != 5 {
+		t.Errorf("Expected 5 inputs, but was %d.", len(inputs))
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("Expected OnBatchResult to be called once, but was %d.", len(results))
+	}
+	if r := results[0]; r.total != 5 || r.enqueued != 5 || r.failed != 0 {
+		t.Errorf("Unexpected result is reported: %+v.", r)
+	}
+}
+
+func TestAdapter_Handler_SynchronousHandling(t *testing.T) {
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+	config.SynchronousHandling = true
+	config.EnqueueRetryPolicy = nil
+
+	adapter, err := line.NewAdapter(config)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	tests := []struct {
+		failAt   map[string]bool
+		expected int
+	}{
+		{
+			failAt:   map[string]bool{},
+			expected: http.StatusOK,
+		},
+		{
+			// Redelivery would process the enqueued input again, so the webhook is still acknowledged.
+			failAt:   map[string]bool{"message 1": true},
+			expected: http.StatusOK,
+		},
+		{
+			failAt:   map[string]bool{"message 0": true, "message 1": true},
+			expected: http.StatusServiceUnavailable,
+		},
+	}
+
+	var events []string
+	for i := 0; i < 2; i++ {
+		events = append(events, fmt.Sprintf(`{
+			"type": "message",
+			"replyToken": "token%d",
+			"timestamp": 1462629479859,
+			"source": {"type": "user", "userId": "U%d"},
+			"message": {"id": "%d", "type": "text", "text": "message %d"}
+		}`, i, i, i, i))
+	}
+	body := []byte(`{"events": [` + strings.Join(events, ",") + `]}`)
+
+	for i, tt := range tests {
+		failAt := tt.failAt
+		handler, err := adapter.Handler(context.TODO(), func(input sarah.Input) error {
+			if failAt[input.Message()] {
+				return sarah.NewBlockedInputError(1)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error is returned: %s.", err.Error())
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/callback", bytes.NewReader(body))
+		req.Header.Set("X-Line-Signature", linetest.Sign(config.ChannelSecret, body))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		if recorder.Code != tt.expected {
+			t.Errorf("Expected status %d on test #%d, but was %d.", tt.expected, i, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package line
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxTextLength is the maximum number of characters a text message can contain.
+const maxTextLength = 5000
+
+// maxAltTextLength is the maximum number of characters the alternative text of a template, Flex, or imagemap message can contain.
+const maxAltTextLength = 400
+
+// Limits of the template messages other than the buttons template.
+const (
+	maxCarouselColumns       = 10
+	maxCarouselColumnActions = 3
+	confirmTemplateActions   = 2
+)
+
+// ValidationErrors contains all violations of LINE's constraints found by ResponseBuilder.Validate.
+type ValidationErrors []error
+
+// Error returns the concatenated message of all belonging errors.
+func (e ValidationErrors) Error() string {
+	var errs []string
+	for _, err := range e {
+		errs = append(errs, err.Error())
+	}
+	return strings.Join(errs, "\n")
+}
+
+// ResponseBuilder builds sarah.CommandResponse with one or more messages while checking LINE's major constraints for each message type.
+// Validate can be called in a test to catch a malformed response before it is rejected by LINE in production.
+//
+//	builder := line.NewResponseBuilder().
+//		Add(linebot.NewTextMessage("Here is the menu.")).
+//		Add(linebot.NewImageMessage(imageURL, previewURL))
+//	response, err := builder.Build()
+type ResponseBuilder struct {
+	messages []linebot.SendingMessage
+	next     sarah.ContextualFunc
+}
+
+// NewResponseBuilder creates new ResponseBuilder without any message.
+func NewResponseBuilder() *ResponseBuilder {
+	return &ResponseBuilder{}
+}
+
+// Add appends given message to the response.
+func (b *ResponseBuilder) Add(message linebot.SendingMessage) *ResponseBuilder {
+	b.messages = append(b.messages, message)
+	return b
+}
+
+// WithNext sets the function to continue the conversation with the user's next input.
+func (b *ResponseBuilder) WithNext(next sarah.ContextualFunc) *ResponseBuilder {
+	b.next = next
+	return b
+}
+
+// Validate checks all messages against LINE's major constraints and returns ValidationErrors that lists every violation.
+// nil is returned when no violation is found.
+//
+// The checked constraints are the number of messages, the length of texts and alternative texts, media URLs, sticker IDs,
+// the number of actions and columns of buttons, confirm, carousel, and image carousel templates,
+// the size and the number of bubbles of Flex messages, and the number of quick reply buttons.
+// Other constraints such as the length of labels and the content of Flex components are left to LINE.
+func (b *ResponseBuilder) Validate() error {
+	var errs ValidationErrors
+	if len(b.messages) == 0 {
+		errs = append(errs, errors.New("no message is added"))
+	}
+	if len(b.messages) > maxMessagesPerCall {
+		errs = append(errs, fmt.Errorf("%d messages are added, but maximum is %d", len(b.messages), maxMessagesPerCall))
+	}
+
+	for i, message := range b.messages {
+		for _, err := range validateMessage(message) {
+			errs = append(errs, fmt.Errorf("message at index %d: %s", i, err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Build validates the messages and creates new sarah.CommandResponse instance with them.
+func (b *ResponseBuilder) Build() (*sarah.CommandResponse, error) {
+	err := b.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	var userContext *sarah.UserContext
+	if b.next != nil {
+		userContext = sarah.NewUserContext(b.next)
+	}
+
+	return &sarah.CommandResponse{
+		Content:     b.messages,
+		UserContext: userContext,
+	}, nil
+}
+
+func validateMessage(message linebot.SendingMessage) []error {
+	var errs []error
+	switch m := message.(type) {
+	case *linebot.TextMessage:
+		if m.Text == "" {
+			errs = append(errs, errors.New("text must not be empty"))
+		}
+		if length := utf8.RuneCountInString(m.Text); length > maxTextLength {
+			errs = append(errs, fmt.Errorf("text must be %d characters or less, but %d is given", maxTextLength, length))
+		}
+
+	case *linebot.ImageMessage:
+		errs = appendIfErr(errs, validateMediaURL(m.OriginalContentURL))
+		errs = appendIfErr(errs, validateMediaURL(m.PreviewImageURL))
+
+	case *linebot.VideoMessage:
+		errs = appendIfErr(errs, validateMediaURL(m.OriginalContentURL))
+		errs = appendIfErr(errs, validateMediaURL(m.PreviewImageURL))
+
+	case *linebot.AudioMessage:
+		errs = appendIfErr(errs, validateMediaURL(m.OriginalContentURL))
+
+	case *linebot.StickerMessage:
+		if m.PackageID == "" || m.StickerID == "" {
+			errs = append(errs, errors.New("both package ID and sticker ID are required"))
+		}
+
+	case *linebot.TemplateMessage:
+		errs = appendIfErr(errs, validateAltText(m.AltText))
+		switch template := m.Template.(type) {
+		case *linebot.ButtonsTemplate:
+			if len(template.Actions) == 0 || len(template.Actions) > maxButtonsTemplateActions {
+				errs = append(errs, fmt.Errorf("buttons template must contain 1 to %d actions, but %d is given", maxButtonsTemplateActions, len(template.Actions)))
+			}
+			if template.ThumbnailImageURL != "" {
+				errs = appendIfErr(errs, validateMediaURL(template.ThumbnailImageURL))
+			}
+
+		case *linebot.ConfirmTemplate:
+			if len(template.Actions) != confirmTemplateActions {
+				errs = append(errs, fmt.Errorf("confirm template must contain %d actions, but %d is given", confirmTemplateActions, len(template.Actions)))
+			}
+
+		case *linebot.CarouselTemplate:
+			if len(template.Columns) == 0 || len(template.Columns) > maxCarouselColumns {
+				errs = append(errs, fmt.Errorf("carousel template must contain 1 to %d columns, but %d is given", maxCarouselColumns, len(template.Columns)))
+			}
+			for i, column := range template.Columns {
+				if len(column.Actions) == 0 || len(column.Actions) > maxCarouselColumnActions {
+					errs = append(errs, fmt.Errorf("carousel column at index %d must contain 1 to %d actions, but %d is given", i, maxCarouselColumnActions, len(column.Actions)))
+				}
+				if len(column.Actions) != len(template.Columns[0].Actions) {
+					errs = append(errs, fmt.Errorf("carousel column at index %d must contain the same number of actions as the first column", i))
+				}
+				if column.ThumbnailImageURL != "" {
+					errs = appendIfErr(errs, validateMediaURL(column.ThumbnailImageURL))
+				}
+			}
+
+		case *linebot.ImageCarouselTemplate:
+			if len(template.Columns) == 0 || len(template.Columns) > maxCarouselColumns {
+				errs = append(errs, fmt.Errorf("image carousel template must contain 1 to %d columns, but %d is given", maxCarouselColumns, len(template.Columns)))
+			}
+			for _, column := range template.Columns {
+				errs = appendIfErr(errs, validateMediaURL(column.ImageURL))
+			}
+
+		}
+
+	case *linebot.FlexMessage:
+		errs = appendIfErr(errs, validateAltText(m.AltText))
+		switch container := m.Contents.(type) {
+		case *linebot.BubbleContainer:
+			errs = appendIfErr(errs, validateFlexSize(container, maxFlexBubbleSize))
+
+		case *linebot.CarouselContainer:
+			if len(container.Contents) == 0 || len(container.Contents) > maxFlexCarouselBubbles {
+				errs = append(errs, fmt.Errorf("carousel must contain 1 to %d bubbles, but %d is given", maxFlexCarouselBubbles, len(container.Contents)))
+			}
+			errs = appendIfErr(errs, validateFlexSize(container, maxFlexCarouselSize))
+
+		}
+
+	case *linebot.ImagemapMessage:
+		errs = appendIfErr(errs, validateAltText(m.AltText))
+
+	}
+
+	errs = appendIfErr(errs, validateQuickReplies(message))
+
+	return errs
+}
+
+func validateAltText(altText string) error {
+	if altText == "" {
+		return errors.New("alternative text must not be empty")
+	}
+	if length := utf8.RuneCountInString(altText); length > maxAltTextLength {
+		return fmt.Errorf("alternative text must be %d characters or less, but %d is given", maxAltTextLength, length)
+	}
+	return nil
+}
+
+// validateQuickReplies checks the number of quick reply buttons attached to given message.
+// The SDK does not expose the attached buttons, so they are counted in the serialized form of the message.
+func validateQuickReplies(message linebot.SendingMessage) error {
+	serialized, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to serialize message: %s", err.Error())
+	}
+
+	var decoded struct {
+		QuickReply *struct {
+			Items []json.RawMessage `json:"items"`
+		} `json:"quickReply"`
+	}
+	err = json.Unmarshal(serialized, &decoded)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize message: %s", err.Error())
+	}
+
+	if decoded.QuickReply != nil && len(decoded.QuickReply.Items) > maxQuickReplyItems {
+		return fmt.Errorf("%d quick reply buttons are attached, but maximum is %d", len(decoded.QuickReply.Items), maxQuickReplyItems)
+	}
+	return nil
+}
+
+func appendIfErr(errs []error, err error) []error {
+	if err != nil {
+		return append(errs, err)
+	}
+	return errs
+}
@@ -0,0 +1,42 @@
+package line
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+	"sync"
+)
+
+// capture holds the messages the adapter would have sent in capture mode.
+type capture struct {
+	mutex sync.RWMutex
+	last  []linebot.SendingMessage
+}
+
+func (c *capture) store(messages []linebot.SendingMessage) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.last = messages
+}
+
+// WithCaptureMode creates AdapterOption that lets Adapter record outgoing messages instead of sending them to LINE.
+// Replies and pushes always succeed in this mode, and the messages of the latest call can be obtained via Adapter.LastSent.
+// Linking a rich menu is skipped as well.
+//
+// This is meant for tests that drive an input through sarah and assert the outgoing messages without mocking the LINE client.
+func WithCaptureMode() AdapterOption {
+	return func(adapter *Adapter) error {
+		adapter.capture = &capture{}
+		return nil
+	}
+}
+
+// LastSent returns the messages of the latest reply or push recorded in capture mode.
+// This always returns nil unless Adapter is constructed with WithCaptureMode.
+func (adapter *Adapter) LastSent() []linebot.SendingMessage {
+	if adapter.capture == nil {
+		return nil
+	}
+
+	adapter.capture.mutex.RLock()
+	defer adapter.capture.mutex.RUnlock()
+	return adapter.capture.last
+}
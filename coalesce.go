@@ -0,0 +1,148 @@
+package line
+
+import (
+	"context"
+	"github.com/oklahomer/go-sarah/v2"
+	"github.com/oklahomer/go-sarah/v2/log"
+	"sync"
+	"time"
+)
+
+// coalescer buffers consecutive TextInputs from the same sender and merges them into one before enqueueing.
+// Users tend to send several short messages in quick succession that are logically one thought,
+// so this reduces fragmented responses for such chatty users.
+//
+// A buffered input is enqueued after the window, long after the webhook request is handled.
+// Therefore, the event handler and Config.OnBatchResult regard the input as enqueued when it is buffered,
+// and a failure to enqueue the merged input is only logged.
+// The delayed enqueue still retries with Config.EnqueueRetryPolicy.
+type coalescer struct {
+	config       *Config
+	enqueueInput func(sarah.Input) error
+
+	mutex   sync.Mutex
+	stopped bool
+	pending map[string]*pendingText
+	// flushing holds the channels that are closed when the timer finishes enqueueing each sender's merged input.
+	flushing map[string]chan struct{}
+}
+
+type pendingText struct {
+	input *TextInput
+	timer *time.Timer
+	// canceled tells the timer not to enqueue the input because it is dropped on stop or taken over by a subsequent non-text input.
+	canceled bool
+}
+
+// newCoalescer creates new coalescer that buffers TextInputs for Config.CoalesceWindow.
+// Pending inputs are dropped when given context is canceled.
+func newCoalescer(ctx context.Context, config *Config, enqueueInput func(sarah.Input) error) *coalescer {
+	c := &coalescer{
+		config:       config,
+		enqueueInput: enqueueInput,
+		pending:      map[string]*pendingText{},
+		flushing:     map[string]chan struct{}{},
+	}
+
+	go func() {
+		<-ctx.Done()
+		c.stop()
+	}()
+
+	return c
+}
+
+// enqueue buffers given TextInput until no subsequent TextInput arrives from the same sender within the window.
+// Any other input is enqueued immediately, preceded by the sender's pending text if any so the order is preserved.
+func (c *coalescer) enqueue(input sarah.Input) error {
+	c.mutex.Lock()
+
+	key := input.SenderKey()
+	p, buffered := c.pending[key]
+
+	text, ok := input.(*TextInput)
+	if !ok || c.stopped {
+		if buffered {
+			// Take over the buffered text even when its timer has just fired; the timer skips a canceled text.
+			p.timer.Stop()
+			p.canceled = true
+			delete(c.pending, key)
+		}
+		inFlight := c.flushing[key]
+		c.mutex.Unlock()
+
+		if inFlight != nil {
+			// The timer is enqueueing an earlier text. Wait for it so the non-text input does not overtake the text.
+			<-inFlight
+		}
+		if buffered {
+			c.flush(p.input)
+		}
+		return c.enqueueInput(input)
+	}
+	defer c.mutex.Unlock()
+
+	if buffered && !p.timer.Stop() {
+		// The timer already fired and the buffered input is on its way to be enqueued.
+		buffered = false
+	}
+
+	if buffered {
+		// Use the latest message's ID, reply token and timestamp since earlier reply tokens may expire sooner.
+		merged := *text
+		merged.text = p.input.text + "\n" + text.text
+		p.input = &merged
+		p.timer.Reset(c.config.CoalesceWindow)
+		return nil
+	}
+
+	p = &pendingText{input: text}
+	p.timer = time.AfterFunc(c.config.CoalesceWindow, func() {
+		c.mutex.Lock()
+		if p.canceled {
+			c.mutex.Unlock()
+			return
+		}
+		if c.pending[key] == p {
+			delete(c.pending, key)
+		}
+		buffered := p.input
+		done := make(chan struct{})
+		c.flushing[key] = done
+		c.mutex.Unlock()
+
+		c.flush(buffered)
+
+		c.mutex.Lock()
+		if c.flushing[key] == done {
+			delete(c.flushing, key)
+		}
+		c.mutex.Unlock()
+		close(done)
+	})
+	c.pending[key] = p
+	return nil
+}
+
+// flush enqueues given merged input through enqueue so Config.EnqueueRetryPolicy and Config.EventHandlerTimeout apply.
+func (c *coalescer) flush(input *TextInput) {
+	err := enqueue(c.config, input, c.enqueueInput)
+	if err != nil {
+		log.Errorf("Failed to enqueue coalesced input. Input is dropped: %s.", err.Error())
+	}
+}
+
+// stop stops all pending timers and drops the buffered inputs.
+// Subsequent inputs are enqueued immediately without buffering.
+func (c *coalescer) stop() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.stopped = true
+	for key, p := range c.pending {
+		p.timer.Stop()
+		p.canceled = true
+		delete(c.pending, key)
+		log.Warnf("Dropping coalesced input from %s on shutdown.", key)
+	}
+}
@@ -0,0 +1,84 @@
+package line
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+)
+
+// contentExtensions maps the content types LINE serves to the common file extensions.
+// mime.ExtensionsByType is not used for these since its result depends on the platform's MIME database and may be something like ".jfif" for image/jpeg.
+var contentExtensions = map[string]string{
+	"image/jpeg":  ".jpg",
+	"image/png":   ".png",
+	"image/gif":   ".gif",
+	"video/mp4":   ".mp4",
+	"audio/m4a":   ".m4a",
+	"audio/x-m4a": ".m4a",
+	"audio/mp4":   ".m4a",
+}
+
+// contentExtension returns the file extension for given content type, or an empty string when none is known.
+func contentExtension(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	if ext, ok := contentExtensions[mediaType]; ok {
+		return ext
+	}
+
+	exts, err := mime.ExtensionsByType(mediaType)
+	if err != nil || len(exts) == 0 {
+		return ""
+	}
+	return exts[0]
+}
+
+// DownloadContentToFile downloads the content of the image, video, audio, or file message with given ID and stores it in the dir directory.
+// The file is uniquely named after the message ID and the extension derived from its content type; the path to the file is returned.
+//
+// When Config.MaxContentSize is positive, a content larger than that is rejected.
+// On any error, the partially written file is removed.
+func (adapter *Adapter) DownloadContentToFile(ctx context.Context, messageID, dir string) (string, error) {
+	res, err := adapter.client.GetMessageContent(messageID).WithContext(ctx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to get content: %s", err.Error())
+	}
+	defer res.Content.Close()
+
+	limit := adapter.config.MaxContentSize
+	if limit > 0 && res.ContentLength > limit {
+		return "", fmt.Errorf("content size %d exceeds the limit of %d", res.ContentLength, limit)
+	}
+
+	file, err := ioutil.TempFile(dir, messageID+"-*"+contentExtension(res.ContentType))
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %s", err.Error())
+	}
+
+	var reader io.Reader = res.Content
+	if limit > 0 {
+		// Read one more byte to detect the excess even when Content-Length is not provided.
+		reader = io.LimitReader(res.Content, limit+1)
+	}
+
+	written, err := io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil && limit > 0 && written > limit {
+		err = fmt.Errorf("content size exceeds the limit of %d", limit)
+	}
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(file.Name())
+		return "", fmt.Errorf("failed to store content: %s", err.Error())
+	}
+
+	return file.Name(), nil
+}
@@ -0,0 +1,83 @@
+package line
+
+import (
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"strings"
+)
+
+// DescribeOutput returns a human-readable summary of given sarah.Output for logging and auditing.
+// Every content type Adapter.SendMessage understands is described, and each message is rendered on its own line.
+//
+//	log.Infof("Sending to %v: %s", output.Destination(), line.DescribeOutput(output))
+func DescribeOutput(output sarah.Output) string {
+	var lines []string
+	switch content := output.Content().(type) {
+	case []linebot.SendingMessage:
+		for _, message := range content {
+			lines = append(lines, describeMessage(message))
+		}
+
+	case linebot.SendingMessage:
+		lines = append(lines, describeMessage(content))
+
+	case *sarah.CommandHelps:
+		for _, commandHelp := range *content {
+			lines = append(lines, fmt.Sprintf("help: %s", commandHelp.Instruction))
+		}
+
+	case *FallbackContent:
+		lines = append(lines, describeMessage(content.Rich))
+		lines = append(lines, fmt.Sprintf("fallback: %s", content.Fallback))
+
+	case *DeferredContent:
+		lines = append(lines, describeMessage(content.Interim))
+		lines = append(lines, fmt.Sprintf("deferred: push to %s", content.ConversationID))
+
+	case *RichMenuContent:
+		lines = append(lines, describeMessage(content.Message))
+		lines = append(lines, fmt.Sprintf("rich menu: link %s to %s", content.RichMenuID, content.UserID))
+
+	default:
+		lines = append(lines, fmt.Sprintf("unknown: %T", content))
+
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func describeMessage(message linebot.SendingMessage) string {
+	switch m := message.(type) {
+	case *linebot.TextMessage:
+		return fmt.Sprintf("text: %s", m.Text)
+
+	case *linebot.ImageMessage:
+		return fmt.Sprintf("image: %s", m.OriginalContentURL)
+
+	case *linebot.VideoMessage:
+		return fmt.Sprintf("video: %s", m.OriginalContentURL)
+
+	case *linebot.AudioMessage:
+		return fmt.Sprintf("audio: %s", m.OriginalContentURL)
+
+	case *linebot.LocationMessage:
+		return fmt.Sprintf("location: %s (%f, %f)", m.Title, m.Latitude, m.Longitude)
+
+	case *linebot.StickerMessage:
+		return fmt.Sprintf("sticker: %s/%s", m.PackageID, m.StickerID)
+
+	case *linebot.TemplateMessage:
+		return fmt.Sprintf("template: %s", m.AltText)
+
+	case *linebot.ImagemapMessage:
+		return fmt.Sprintf("imagemap: %s", m.AltText)
+
+	case *linebot.FlexMessage:
+		return fmt.Sprintf("flex: %s", m.AltText)
+
+	default:
+		return fmt.Sprintf("message: %T", message)
+
+	}
+}
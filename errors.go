@@ -0,0 +1,26 @@
+package line
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyedErrors contains errors that occurred while processing multiple targets concurrently.
+// Each key is the ID of the target that failed, so the caller can tell which ones to retry or skip.
+type KeyedErrors map[string]error
+
+// Error returns the concatenated message of all belonging errors in the order of keys.
+func (e KeyedErrors) Error() string {
+	var keys []string
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []string
+	for _, key := range keys {
+		errs = append(errs, fmt.Sprintf("%s: %s", key, e[key].Error()))
+	}
+	return strings.Join(errs, "\n")
+}
@@ -0,0 +1,216 @@
+package line
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+)
+
+// Maximum serialized sizes of Flex containers that LINE accepts.
+const (
+	maxFlexBubbleSize   = 30 * 1024
+	maxFlexCarouselSize = 50 * 1024
+)
+
+// maxFlexCarouselBubbles is the maximum number of bubbles a carousel container can contain.
+const maxFlexCarouselBubbles = 12
+
+// validateFlexSize checks if the JSON-serialized size of given container is within given limit.
+// LINE rejects the whole message when a container is too large, so this lets the developer notice the problem with the offending size before sending.
+func validateFlexSize(container linebot.FlexContainer, limit int) error {
+	serialized, err := json.Marshal(container)
+	if err != nil {
+		return fmt.Errorf("failed to serialize flex container: %s", err.Error())
+	}
+	if len(serialized) > limit {
+		return fmt.Errorf("serialized %T is %d bytes, which exceeds the limit of %d bytes", container, len(serialized), limit)
+	}
+	return nil
+}
+
+// NewFlexCarouselResponse creates new sarah.CommandResponse instance with a Flex message that contains given bubbles as a swipeable carousel.
+// An error is returned when no bubble or more than 12 bubbles are given, or when any bubble or the carousel as a whole exceeds the size LINE accepts.
+func NewFlexCarouselResponse(altText string, bubbles ...*linebot.BubbleContainer) (*sarah.CommandResponse, error) {
+	if len(bubbles) == 0 {
+		return nil, errors.New("carousel requires at least one bubble")
+	}
+	if len(bubbles) > maxFlexCarouselBubbles {
+		return nil, fmt.Errorf("%d bubbles are given, but carousel can contain %d bubbles at most", len(bubbles), maxFlexCarouselBubbles)
+	}
+
+	for i, bubble := range bubbles {
+		if err := validateFlexSize(bubble, maxFlexBubbleSize); err != nil {
+			return nil, fmt.Errorf("bubble at index %d is invalid: %s", i, err.Error())
+		}
+	}
+
+	carousel := &linebot.CarouselContainer{
+		Type:     linebot.FlexContainerTypeCarousel,
+		Contents: bubbles,
+	}
+	if err := validateFlexSize(carousel, maxFlexCarouselSize); err != nil {
+		return nil, err
+	}
+
+	return &sarah.CommandResponse{
+		Content:     linebot.NewFlexMessage(altText, carousel),
+		UserContext: nil,
+	}, nil
+}
+
+// CatalogItem represents an item to be shown as a card in the catalog carousel built by NewCatalogResponse.
+type CatalogItem struct {
+	Title    string
+	ImageURL string
+	Price    string
+	// Action is bound to the card's footer button. Its label is used as the button label.
+	Action linebot.TemplateAction
+}
+
+// NewCatalogResponse creates new sarah.CommandResponse instance with a Flex carousel that contains one card for each given item.
+// Each card consists of the item image, title, price, and a footer button that triggers the item's action.
+// An error is returned when any item's image URL is not HTTPS or exceeds 2000 characters, when no item or more than 12 items are given,
+// or when the resulting carousel exceeds the size LINE accepts.
+func NewCatalogResponse(altText string, items []*CatalogItem) (*sarah.CommandResponse, error) {
+	var bubbles []*linebot.BubbleContainer
+	for i, item := range items {
+		if item.ImageURL != "" {
+			if err := validateMediaURL(item.ImageURL); err != nil {
+				return nil, fmt.Errorf("item at index %d is invalid: %s", i, err.Error())
+			}
+		}
+
+		bubble := &linebot.BubbleContainer{
+			Type: linebot.FlexContainerTypeBubble,
+			Body: &linebot.BoxComponent{
+				Type:   linebot.FlexComponentTypeBox,
+				Layout: linebot.FlexBoxLayoutTypeVertical,
+				Contents: []linebot.FlexComponent{
+					&linebot.TextComponent{
+						Type:   linebot.FlexComponentTypeText,
+						Text:   item.Title,
+						Size:   linebot.FlexTextSizeTypeLg,
+						Weight: linebot.FlexTextWeightTypeBold,
+						Wrap:   true,
+					},
+					&linebot.TextComponent{
+						Type: linebot.FlexComponentTypeText,
+						Text: item.Price,
+						Size: linebot.FlexTextSizeTypeMd,
+					},
+				},
+			},
+		}
+
+		if item.ImageURL != "" {
+			bubble.Hero = &linebot.ImageComponent{
+				Type:        linebot.FlexComponentTypeImage,
+				URL:         item.ImageURL,
+				Size:        linebot.FlexImageSizeTypeFull,
+				AspectMode:  linebot.FlexImageAspectModeTypeCover,
+				AspectRatio: linebot.FlexImageAspectRatioType20to13,
+			}
+		}
+
+		if item.Action != nil {
+			bubble.Footer = &linebot.BoxComponent{
+				Type:   linebot.FlexComponentTypeBox,
+				Layout: linebot.FlexBoxLayoutTypeVertical,
+				Contents: []linebot.FlexComponent{
+					&linebot.ButtonComponent{
+						Type:   linebot.FlexComponentTypeButton,
+						Action: item.Action,
+						Style:  linebot.FlexButtonStyleTypePrimary,
+					},
+				},
+			}
+		}
+
+		bubbles = append(bubbles, bubble)
+	}
+
+	return NewFlexCarouselResponse(altText, bubbles...)
+}
+
+// BubbleBuilder builds linebot.BubbleContainer in a fluent way.
+// Each block is laid out as a vertical box of given components, which covers the common layout of texts and buttons.
+//
+//	bubble := line.FlexBubble().
+//		Header(line.FlexText("Order")).
+//		Body(line.FlexText("Pizza"), line.FlexText("$10")).
+//		Footer(line.FlexButton(linebot.NewPostbackAction("Buy", "action=buy", "", "Buy"))).
+//		Build()
+type BubbleBuilder struct {
+	bubble *linebot.BubbleContainer
+}
+
+// FlexBubble creates new BubbleBuilder with an empty bubble.
+func FlexBubble() *BubbleBuilder {
+	return &BubbleBuilder{
+		bubble: &linebot.BubbleContainer{
+			Type: linebot.FlexContainerTypeBubble,
+		},
+	}
+}
+
+func verticalBox(components []linebot.FlexComponent) *linebot.BoxComponent {
+	return &linebot.BoxComponent{
+		Type:     linebot.FlexComponentTypeBox,
+		Layout:   linebot.FlexBoxLayoutTypeVertical,
+		Contents: components,
+	}
+}
+
+// Header sets the header block that contains given components.
+func (b *BubbleBuilder) Header(components ...linebot.FlexComponent) *BubbleBuilder {
+	b.bubble.Header = verticalBox(components)
+	return b
+}
+
+// Hero sets the hero block that shows the image at given URL across the bubble's width.
+func (b *BubbleBuilder) Hero(imageURL string) *BubbleBuilder {
+	b.bubble.Hero = &linebot.ImageComponent{
+		Type:        linebot.FlexComponentTypeImage,
+		URL:         imageURL,
+		Size:        linebot.FlexImageSizeTypeFull,
+		AspectMode:  linebot.FlexImageAspectModeTypeCover,
+		AspectRatio: linebot.FlexImageAspectRatioType20to13,
+	}
+	return b
+}
+
+// Body sets the body block that contains given components.
+func (b *BubbleBuilder) Body(components ...linebot.FlexComponent) *BubbleBuilder {
+	b.bubble.Body = verticalBox(components)
+	return b
+}
+
+// Footer sets the footer block that contains given components.
+func (b *BubbleBuilder) Footer(components ...linebot.FlexComponent) *BubbleBuilder {
+	b.bubble.Footer = verticalBox(components)
+	return b
+}
+
+// Build returns the built linebot.BubbleContainer.
+func (b *BubbleBuilder) Build() *linebot.BubbleContainer {
+	return b.bubble
+}
+
+// FlexText creates new text component with given text, which wraps when the text is longer than the width.
+func FlexText(text string) *linebot.TextComponent {
+	return &linebot.TextComponent{
+		Type: linebot.FlexComponentTypeText,
+		Text: text,
+		Wrap: true,
+	}
+}
+
+// FlexButton creates new button component that triggers given action. The action's label is used as the button label.
+func FlexButton(action linebot.TemplateAction) *linebot.ButtonComponent {
+	return &linebot.ButtonComponent{
+		Type:   linebot.FlexComponentTypeButton,
+		Action: action,
+	}
+}
@@ -0,0 +1,136 @@
+package line
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/oklahomer/go-sarah/v2/log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrTemporaryContentDisabled indicates that HostTemporaryContent is called while the content hosting is not enabled.
+// Config.TemporaryContentPath must be set to enable the content hosting; NewAdapter returns an error when Config.CallbackURL is not HTTPS in that case.
+var ErrTemporaryContentDisabled = errors.New("temporary content hosting is not enabled")
+
+// contentHost stores generated contents in Store and serves them at signed, expiring URLs.
+type contentHost struct {
+	secret []byte
+	store  Store
+}
+
+func newContentHost(secret string, store Store) *contentHost {
+	return &contentHost{
+		secret: []byte(secret),
+		store:  store,
+	}
+}
+
+func (h *contentHost) sign(id string, expires int64) string {
+	hash := hmac.New(sha256.New, h.secret)
+	_, _ = hash.Write([]byte(fmt.Sprintf("%s:%d", id, expires)))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func contentStoreKey(id string) string {
+	return "line:temporary_content:" + id
+}
+
+// add stores given content and returns its ID along with the query string to access it.
+// The content type is stored in front of the data, separated by a NUL byte that never appears in a content type.
+func (h *contentHost) add(ctx context.Context, data []byte, contentType string, ttl time.Duration) (string, string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate content ID: %s", err.Error())
+	}
+	id := hex.EncodeToString(b)
+	expiresAt := time.Now().Add(ttl)
+
+	value := append([]byte(contentType+"\x00"), data...)
+	err = h.store.Put(ctx, contentStoreKey(id), value, ttl)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store content: %s", err.Error())
+	}
+
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("signature", h.sign(id, expiresAt.Unix()))
+	return id, query.Encode(), nil
+}
+
+func (h *contentHost) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	id := req.URL.Path[strings.LastIndex(req.URL.Path, "/")+1:]
+	expires, err := strconv.ParseInt(req.URL.Query().Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		http.NotFound(w, req)
+		return
+	}
+
+	signature := req.URL.Query().Get("signature")
+	if !hmac.Equal([]byte(signature), []byte(h.sign(id, expires))) {
+		http.NotFound(w, req)
+		return
+	}
+
+	value, ok, err := h.store.Get(req.Context(), contentStoreKey(id))
+	if err != nil {
+		log.Errorf("Failed to get temporary content %s: %s.", id, err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	separator := bytes.IndexByte(value, 0)
+	if !ok || separator < 0 {
+		http.NotFound(w, req)
+		return
+	}
+
+	data := value[separator+1:]
+	w.Header().Set("Content-Type", string(value[:separator]))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+// HostTemporaryContent serves given data on the adapter's HTTP server and returns a signed URL to access it.
+// This is handy to reply with an image generated on the fly, since an image message requires the image to be hosted at an HTTPS URL.
+//
+//	imageURL, err := adapter.HostTemporaryContent(ctx, chart, "image/png")
+//	if err != nil {
+//		return nil, err
+//	}
+//	return line.NewImageResponse(imageURL, imageURL)
+//
+// The URL is built on Config.CallbackURL and Config.TemporaryContentPath, and expires after Config.TemporaryContentTTL.
+// ErrTemporaryContentDisabled is returned when Config.TemporaryContentPath is not set.
+// Contents are held in the Store given via WithStore, which is in memory by default.
+func (adapter *Adapter) HostTemporaryContent(ctx context.Context, data []byte, contentType string) (string, error) {
+	if adapter.contentHost == nil {
+		return "", ErrTemporaryContentDisabled
+	}
+
+	base, err := url.Parse(adapter.config.CallbackURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse callback URL: %s", err.Error())
+	}
+
+	id, query, err := adapter.contentHost.add(ctx, data, contentType, adapter.config.TemporaryContentTTL)
+	if err != nil {
+		return "", err
+	}
+
+	u := &url.URL{
+		Scheme:   base.Scheme,
+		Host:     base.Host,
+		Path:     strings.TrimSuffix(adapter.config.TemporaryContentPath, "/") + "/" + id,
+		RawQuery: query,
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,119 @@
+/*
+Package linetest provides utilities to test a bot built on LINE Adapter without talking to the real LINE platform.
+
+PostEvent lets developers verify the whole webhook pipeline, signature validation, event parsing, input conversion and enqueueing,
+by posting a signed payload to the adapter's handler running on httptest.Server.
+PostPayload posts an arbitrary payload and signature so the rejection of tampered payloads can be tested as well.
+*/
+package linetest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah-line"
+	"github.com/oklahomer/go-sarah/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// WebhookAdapter is the part of line.Adapter that PostEvent and PostPayload depend on.
+type WebhookAdapter interface {
+	Handler(context.Context, func(sarah.Input) error) (http.Handler, error)
+}
+
+var _ WebhookAdapter = (*line.Adapter)(nil)
+
+// Sign returns the value of X-Line-Signature header for given request body.
+func Sign(channelSecret string, body []byte) string {
+	hash := hmac.New(sha256.New, []byte(channelSecret))
+	_, _ = hash.Write(body)
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
+
+// PostEvent signs given events with channelSecret, posts them to the adapter's webhook handler, and returns the enqueued inputs.
+// channelSecret must be the one the adapter is configured with; otherwise the signature validation fails and so does the test.
+//
+//	input := linetest.PostEvent(t, adapter, config.ChannelSecret, event)[0]
+//	if input.Message() != "Hello" {
+//		t.Errorf("Unexpected message: %s.", input.Message())
+//	}
+//
+// Inputs are collected when the webhook request is handled, so an event handler that enqueues inputs asynchronously is not supported.
+// For the same reason, text inputs are not returned when Config.CoalesceWindow is positive since they are buffered beyond the request.
+func PostEvent(t testing.TB, adapter WebhookAdapter, channelSecret string, events ...*linebot.Event) []sarah.Input {
+	t.Helper()
+
+	body, err := json.Marshal(&struct {
+		Events []*linebot.Event `json:"events"`
+	}{
+		Events: events,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal events: %s.", err.Error())
+	}
+
+	status, inputs := PostPayload(t, adapter, Sign(channelSecret, body), body)
+	if status != http.StatusOK {
+		t.Fatalf("Unexpected status code is returned: %d.", status)
+	}
+	return inputs
+}
+
+// PostPayload posts given raw body with given X-Line-Signature header value to the adapter's webhook handler,
+// and returns the response status code along with the enqueued inputs.
+// Unlike PostEvent, this does not fail the test on non-200 status so tampered or malformed payloads can be tested.
+//
+//	called := false
+//	adapter, _ := line.NewAdapter(config, line.WithRequestErrorHandler(func(err error, _ *http.Request) {
+//		called = err == linebot.ErrInvalidSignature
+//	}))
+//	status, _ := linetest.PostPayload(t, adapter, "invalid", body)
+//	if status != http.StatusBadRequest || !called {
+//		t.Error("Tampered payload is not rejected.")
+//	}
+func PostPayload(t testing.TB, adapter WebhookAdapter, signature string, body []byte) (int, []sarah.Input) {
+	t.Helper()
+
+	var mutex sync.Mutex
+	var inputs []sarah.Input
+	enqueueInput := func(input sarah.Input) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		inputs = append(inputs, input)
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler, err := adapter.Handler(ctx, enqueueInput)
+	if err != nil {
+		t.Fatalf("Failed to build webhook handler: %s.", err.Error())
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %s.", err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Line-Signature", signature)
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("Failed to post payload: %s.", err.Error())
+	}
+	_ = resp.Body.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return resp.StatusCode, inputs
+}
@@ -0,0 +1,73 @@
+package line
+
+import (
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"net/url"
+	"time"
+)
+
+// maxMediaURLLength is the maximum length of a media URL that LINE accepts.
+const maxMediaURLLength = 2000
+
+// validateMediaURL checks if given URL is acceptable as the URL of an image, video, or audio message.
+// LINE rejects the whole message when the URL is not HTTPS or is too long, so this lets the developer notice the problem before sending.
+func validateMediaURL(rawURL string) error {
+	if len(rawURL) > maxMediaURLLength {
+		return fmt.Errorf("URL must be %d characters or less, but %d is given", maxMediaURLLength, len(rawURL))
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse URL %s: %s", rawURL, err.Error())
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("URL must be HTTPS, but %s is given", rawURL)
+	}
+
+	return nil
+}
+
+// NewImageResponse creates new sarah.CommandResponse instance with an image message.
+// An error is returned when any of the given URLs is not HTTPS or exceeds 2000 characters.
+func NewImageResponse(originalContentURL, previewImageURL string) (*sarah.CommandResponse, error) {
+	for _, u := range []string{originalContentURL, previewImageURL} {
+		if err := validateMediaURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sarah.CommandResponse{
+		Content:     linebot.NewImageMessage(originalContentURL, previewImageURL),
+		UserContext: nil,
+	}, nil
+}
+
+// NewVideoResponse creates new sarah.CommandResponse instance with a video message.
+// An error is returned when any of the given URLs is not HTTPS or exceeds 2000 characters.
+func NewVideoResponse(originalContentURL, previewImageURL string) (*sarah.CommandResponse, error) {
+	for _, u := range []string{originalContentURL, previewImageURL} {
+		if err := validateMediaURL(u); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sarah.CommandResponse{
+		Content:     linebot.NewVideoMessage(originalContentURL, previewImageURL),
+		UserContext: nil,
+	}, nil
+}
+
+// NewAudioResponse creates new sarah.CommandResponse instance with an audio message of given length.
+// An error is returned when the given URL is not HTTPS or exceeds 2000 characters.
+func NewAudioResponse(originalContentURL string, duration time.Duration) (*sarah.CommandResponse, error) {
+	if err := validateMediaURL(originalContentURL); err != nil {
+		return nil, err
+	}
+
+	return &sarah.CommandResponse{
+		Content:     linebot.NewAudioMessage(originalContentURL, int(duration/time.Millisecond)),
+		UserContext: nil,
+	}, nil
+}
@@ -0,0 +1,230 @@
+package line
+
+import (
+	"errors"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	pageCursorKeyParam  = "cursor"
+	pageCursorPageParam = "page"
+
+	expiringDataParam    = "data"
+	expiringExpiresParam = "expires"
+)
+
+// EncodePageCursor builds postback data that points to the given page of the list identified by key.
+// The returned value can be decoded with ParsePageCursor.
+func EncodePageCursor(key string, page int) string {
+	values := url.Values{}
+	values.Set(pageCursorKeyParam, key)
+	values.Set(pageCursorPageParam, strconv.Itoa(page))
+	return values.Encode()
+}
+
+// ParsePageCursor decodes the postback data built by EncodePageCursor.
+// This returns false when given input is not a PostbackEvent or its data is not a page cursor.
+//
+//	key, page, ok := line.ParsePageCursor(input)
+//	if ok && key == "products" {
+//		return line.NewPaginatedResponse("products", products, page, 10, "Show more")
+//	}
+func ParsePageCursor(input sarah.Input) (string, int, bool) {
+	postback, ok := input.(*PostbackEvent)
+	if !ok {
+		return "", 0, false
+	}
+
+	values, err := url.ParseQuery(postback.Message())
+	if err != nil {
+		return "", 0, false
+	}
+
+	key := values.Get(pageCursorKeyParam)
+	if key == "" {
+		return "", 0, false
+	}
+
+	page, err := strconv.Atoi(values.Get(pageCursorPageParam))
+	if err != nil || page < 0 {
+		return "", 0, false
+	}
+
+	return key, page, true
+}
+
+// NewPaginatedResponse creates new sarah.CommandResponse instance that lists the given page of items in a text message.
+// page starts from zero and each page contains perPage items.
+//
+// When more items follow, a quick reply button with moreLabel is attached.
+// Tapping the button sends a postback whose data is a page cursor for the next page; use ParsePageCursor to decode it.
+//
+// An error is returned when no item is given or the page is out of range, since LINE rejects a text message with empty text.
+func NewPaginatedResponse(key string, items []string, page, perPage int, moreLabel string) (*sarah.CommandResponse, error) {
+	if page < 0 {
+		page = 0
+	}
+	if perPage < 1 {
+		perPage = 1
+	}
+
+	start := page * perPage
+	if start >= len(items) {
+		return nil, fmt.Errorf("page %d is out of range for %d items with %d items per page", page, len(items), perPage)
+	}
+	end := start + perPage
+	if end > len(items) {
+		end = len(items)
+	}
+
+	message := linebot.NewTextMessage(strings.Join(items[start:end], "\n"))
+	if end < len(items) {
+		action := linebot.NewPostbackAction(moreLabel, EncodePageCursor(key, page+1), "", moreLabel)
+		quickReply := linebot.NewQuickReplyItems(linebot.NewQuickReplyButton("", action))
+		return &sarah.CommandResponse{
+			Content:     message.WithQuickReplies(quickReply),
+			UserContext: nil,
+		}, nil
+	}
+
+	return &sarah.CommandResponse{
+		Content:     message,
+		UserContext: nil,
+	}, nil
+}
+
+// ErrPostbackExpired indicates that the postback is sent after the expiry embedded by EncodeExpiringPostbackData.
+var ErrPostbackExpired = errors.New("postback is expired")
+
+// EncodeExpiringPostbackData builds postback data that carries given data along with its expiry.
+// This is handy for buttons that are valid only for a limited time such as a flash sale; use DecodeExpiringPostbackData to decode it.
+func EncodeExpiringPostbackData(data string, expiresAt time.Time) string {
+	values := url.Values{}
+	values.Set(expiringDataParam, data)
+	values.Set(expiringExpiresParam, strconv.FormatInt(expiresAt.Unix(), 10))
+	return values.Encode()
+}
+
+// DecodeExpiringPostbackData decodes the postback data built by EncodeExpiringPostbackData and returns the original data.
+// ErrPostbackExpired is returned along with the original data when the postback is sent after the expiry,
+// so the command can tell the user that the offer is over.
+//
+//	data, err := line.DecodeExpiringPostbackData(input)
+//	if err == line.ErrPostbackExpired {
+//		return line.NewStringResponse("Sorry, this sale is already over."), nil
+//	}
+//
+// Other error is returned when given input is not a PostbackEvent or its data is not built by EncodeExpiringPostbackData.
+func DecodeExpiringPostbackData(input sarah.Input) (string, error) {
+	postback, ok := input.(*PostbackEvent)
+	if !ok {
+		return "", fmt.Errorf("postback event is expected, but %T is given", input)
+	}
+
+	values, err := url.ParseQuery(postback.Message())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse postback data: %s", err.Error())
+	}
+
+	expires, err := strconv.ParseInt(values.Get(expiringExpiresParam), 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("postback data does not contain valid expiry: %s", err.Error())
+	}
+
+	data := values.Get(expiringDataParam)
+	if postback.SentAt().After(time.Unix(expires, 0)) {
+		return data, ErrPostbackExpired
+	}
+
+	return data, nil
+}
+
+// maxQuickReplyItems is the maximum number of quick reply buttons that can be attached to a message.
+const maxQuickReplyItems = 13
+
+// FeedbackOption represents a choice presented by NewFeedbackResponse.
+// Label is shown on the quick reply button and Data is sent back as the postback data when the button is tapped.
+type FeedbackOption struct {
+	Label string
+	Data  string
+}
+
+// NewFeedbackResponse creates new sarah.CommandResponse instance with given string and a row of quick reply buttons to collect the user's feedback.
+// Each option is rendered as a button that sends a postback with its Data, while the option's Label is displayed in the chat as the user's answer.
+//
+//	line.NewFeedbackResponse("Was this helpful?", []*line.FeedbackOption{
+//		{Label: "Yes", Data: "feedback=yes"},
+//		{Label: "No", Data: "feedback=no"},
+//	})
+//
+// An error is returned when no option or more than 13 options are given.
+func NewFeedbackResponse(text string, options []*FeedbackOption) (*sarah.CommandResponse, error) {
+	if len(options) == 0 {
+		return nil, errors.New("no feedback option is given")
+	}
+	if len(options) > maxQuickReplyItems {
+		return nil, fmt.Errorf("%d feedback options are given, but maximum is %d", len(options), maxQuickReplyItems)
+	}
+
+	var buttons []*linebot.QuickReplyButton
+	for _, option := range options {
+		action := linebot.NewPostbackAction(option.Label, option.Data, "", option.Label)
+		buttons = append(buttons, linebot.NewQuickReplyButton("", action))
+	}
+
+	return &sarah.CommandResponse{
+		Content:     linebot.NewTextMessage(text).WithQuickReplies(linebot.NewQuickReplyItems(buttons...)),
+		UserContext: nil,
+	}, nil
+}
+
+// NewPaginatedQuickReplyResponse creates new sarah.CommandResponse instance with given string and the given page of quick reply buttons.
+// LINE allows up to 13 quick reply buttons per message, so when more actions follow, the page shows 12 of them and a button with moreLabel.
+// Tapping the button sends a postback whose data is a page cursor for the next page; use ParsePageCursor to decode it.
+//
+//	key, page, ok := line.ParsePageCursor(input)
+//	if !ok || key != "colors" {
+//		page = 0
+//	}
+//	return line.NewPaginatedQuickReplyResponse("colors", "Pick a color.", colorActions, page, "More"), nil
+func NewPaginatedQuickReplyResponse(key, text string, actions []linebot.QuickReplyAction, page int, moreLabel string) *sarah.CommandResponse {
+	perPage := maxQuickReplyItems - 1 // Leave room for the "more" button.
+	if page < 0 {
+		page = 0
+	}
+
+	start := page * perPage
+	if start > len(actions) {
+		start = len(actions)
+	}
+	end := len(actions)
+	hasMore := end-start > maxQuickReplyItems
+	if hasMore {
+		end = start + perPage
+	}
+
+	var buttons []*linebot.QuickReplyButton
+	for _, action := range actions[start:end] {
+		buttons = append(buttons, linebot.NewQuickReplyButton("", action))
+	}
+	if hasMore {
+		more := linebot.NewPostbackAction(moreLabel, EncodePageCursor(key, page+1), "", moreLabel)
+		buttons = append(buttons, linebot.NewQuickReplyButton("", more))
+	}
+
+	var message linebot.SendingMessage = linebot.NewTextMessage(text)
+	if len(buttons) > 0 {
+		message = message.WithQuickReplies(linebot.NewQuickReplyItems(buttons...))
+	}
+
+	return &sarah.CommandResponse{
+		Content:     message,
+		UserContext: nil,
+	}
+}
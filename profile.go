@@ -0,0 +1,144 @@
+package line
+
+import (
+	"context"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ProfileErrors contains errors that occurred while fetching multiple profiles.
+// Each key is the user ID whose profile could not be fetched; the user may have blocked the bot or restricted the privacy setting.
+type ProfileErrors = KeyedErrors
+
+// ResolveJoinedProfiles fetches the profiles of the members who joined a group or room with given memberJoined event.
+// Profiles are fetched concurrently and returned in the order of the joined members.
+// At most Config.SendConcurrency requests are sent at the same time, shared with other fan-out operations such as PushToGroups.
+//
+// When some profiles can not be fetched, the successfully fetched ones are still returned along with ProfileErrors.
+// Such a memberJoined event is not treated as user input, so this is typically called in a customized event handler given via WithEventHandler.
+func (adapter *Adapter) ResolveJoinedProfiles(ctx context.Context, event *linebot.Event) ([]*linebot.UserProfileResponse, error) {
+	if event.Type != linebot.EventTypeMemberJoined {
+		return nil, fmt.Errorf("memberJoined event is expected, but %s is given", event.Type)
+	}
+	if event.Source == nil {
+		return nil, ErrUnrecognizedEventSource
+	}
+
+	var fetch func(reqCtx context.Context, userID string) (*linebot.UserProfileResponse, error)
+	switch event.Source.Type {
+	case linebot.EventSourceTypeGroup:
+		fetch = func(reqCtx context.Context, userID string) (*linebot.UserProfileResponse, error) {
+			return adapter.client.GetGroupMemberProfile(event.Source.GroupID, userID).WithContext(reqCtx).Do()
+		}
+
+	case linebot.EventSourceTypeRoom:
+		fetch = func(reqCtx context.Context, userID string) (*linebot.UserProfileResponse, error) {
+			return adapter.client.GetRoomMemberProfile(event.Source.RoomID, userID).WithContext(reqCtx).Do()
+		}
+
+	default:
+		return nil, ErrUnrecognizedEventSource
+
+	}
+
+	profiles := make([]*linebot.UserProfileResponse, len(event.Members))
+	errs := ProfileErrors{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i, member := range event.Members {
+		wg.Add(1)
+		adapter.sendSemaphore <- struct{}{}
+		go func(i int, userID string) {
+			defer func() {
+				<-adapter.sendSemaphore
+				wg.Done()
+			}()
+
+			reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			profile, err := fetch(reqCtx, userID)
+			if err != nil {
+				mutex.Lock()
+				errs[userID] = err
+				mutex.Unlock()
+				return
+			}
+			profiles[i] = profile
+		}(i, member.UserID)
+	}
+	wg.Wait()
+
+	var resolved []*linebot.UserProfileResponse
+	for _, profile := range profiles {
+		if profile != nil {
+			resolved = append(resolved, profile)
+		}
+	}
+
+	if len(errs) > 0 {
+		return resolved, errs
+	}
+	return resolved, nil
+}
+
+// IsFriend checks if the user with given ID has added the bot as a friend and has not blocked it.
+// LINE responds with 404 to a profile request for such a user, so false is returned without an error in that case.
+// Any other failure is returned as an error so a temporary API failure is not mistaken for a blocked user.
+func (adapter *Adapter) IsFriend(ctx context.Context, userID string) (bool, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := adapter.client.GetProfile(userID).WithContext(reqCtx).Do()
+	if err == nil {
+		return true, nil
+	}
+
+	if apiErr, ok := err.(*linebot.APIError); ok && apiErr.Code == http.StatusNotFound {
+		return false, nil
+	}
+
+	return false, err
+}
+
+// Profiles fetches the profiles of the users with given IDs concurrently and returns them keyed by user ID.
+// At most Config.SendConcurrency requests are sent at the same time, shared with other fan-out operations such as PushToGroups.
+//
+// When some profiles can not be fetched, the successfully fetched ones are still returned along with ProfileErrors.
+// A user who has blocked the bot or has not added the bot as a friend is reported via ProfileErrors.
+func (adapter *Adapter) Profiles(ctx context.Context, userIDs []string) (map[string]*linebot.UserProfileResponse, error) {
+	profiles := map[string]*linebot.UserProfileResponse{}
+	errs := ProfileErrors{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, userID := range userIDs {
+		wg.Add(1)
+		adapter.sendSemaphore <- struct{}{}
+		go func(userID string) {
+			defer func() {
+				<-adapter.sendSemaphore
+				wg.Done()
+			}()
+
+			reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			profile, err := adapter.client.GetProfile(userID).WithContext(reqCtx).Do()
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs[userID] = err
+				return
+			}
+			profiles[userID] = profile
+		}(userID)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return profiles, errs
+	}
+	return profiles, nil
+}
@@ -0,0 +1,47 @@
+package line
+
+import (
+	"context"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"sync"
+)
+
+// PushErrors contains errors that occurred while pushing a message to multiple destinations.
+// Each key is the destination ID the message could not be pushed to; the bot may have already left the group.
+type PushErrors = KeyedErrors
+
+// PushToGroups pushes given messages to all groups with given IDs.
+// LINE provides no API to list the groups a bot belongs to, so the developer is responsible for tracking the group IDs.
+// At most Config.SendConcurrency requests are sent at the same time, shared with other fan-out operations such as Profiles.
+//
+// Pushing to one group does not stop on another group's failure.
+// When the message can not be pushed to some groups, PushErrors is returned so the caller can tell which groups failed;
+// the message is delivered to all other groups.
+func (adapter *Adapter) PushToGroups(ctx context.Context, groupIDs []string, messages ...linebot.SendingMessage) error {
+	errs := PushErrors{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, groupID := range groupIDs {
+		wg.Add(1)
+		adapter.sendSemaphore <- struct{}{}
+		go func(groupID string) {
+			defer func() {
+				<-adapter.sendSemaphore
+				wg.Done()
+			}()
+
+			err := adapter.push(ctx, groupID, messages)
+			if err != nil {
+				mutex.Lock()
+				errs[groupID] = err
+				mutex.Unlock()
+			}
+		}(groupID)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package line_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah-line"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// inFlightAPI counts the requests being handled at the same time and records the maximum.
+type inFlightAPI struct {
+	mutex    sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (s *inFlightAPI) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	s.mutex.Lock()
+	s.inFlight++
+	if s.inFlight > s.max {
+		s.max = s.inFlight
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	s.mutex.Lock()
+	s.inFlight--
+	s.mutex.Unlock()
+
+	_, _ = w.Write([]byte(`{}`))
+}
+
+func TestAdapter_SendConcurrency(t *testing.T) {
+	api := &inFlightAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	concurrency := 3
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+	config.APIEndpointBase = server.URL
+	config.SendConcurrency = concurrency
+	adapter, err := line.NewAdapter(config)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	var ids []string
+	for i := 0; i < 20; i++ {
+		ids = append(ids, fmt.Sprintf("id%d", i))
+	}
+
+	// Run the fan-out operations at the same time to make sure they share one limit.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		err := adapter.PushToGroups(context.TODO(), ids, linebot.NewTextMessage("hello"))
+		if err != nil {
+			t.Errorf("Unexpected error is returned: %s.", err.Error())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		_, err := adapter.Profiles(context.TODO(), ids)
+		if err != nil {
+			t.Errorf("Unexpected error is returned: %s.", err.Error())
+		}
+	}()
+	wg.Wait()
+
+	if api.max > concurrency {
+		t.Errorf("Expected at most %d requests in flight, but was %d.", concurrency, api.max)
+	}
+	if api.max == 0 {
+		t.Error("Expected requests to be sent, but none was.")
+	}
+}
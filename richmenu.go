@@ -0,0 +1,101 @@
+package line
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"time"
+)
+
+// CreateRichMenuFromJSON creates a rich menu with given JSON definition and returns the ID of the created rich menu.
+// The JSON is in the same format as the request body of LINE's rich menu creation API, so a layout exported from a design tool can be version-controlled and applied as-is.
+//
+//	definition, _ := ioutil.ReadFile("richmenu.json")
+//	richMenuID, err := adapter.CreateRichMenuFromJSON(ctx, definition)
+//	if err != nil {
+//		return err
+//	}
+//	err = adapter.UploadRichMenuImageFromFile(ctx, richMenuID, "richmenu.png")
+func (adapter *Adapter) CreateRichMenuFromJSON(ctx context.Context, definition []byte) (string, error) {
+	richMenu := linebot.RichMenu{}
+	err := json.Unmarshal(definition, &richMenu)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse rich menu definition: %s", err.Error())
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	res, err := adapter.client.CreateRichMenu(richMenu).WithContext(reqCtx).Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to create rich menu: %s", err.Error())
+	}
+
+	return res.RichMenuID, nil
+}
+
+// UploadRichMenuImageFromFile uploads the image file at given path and sets it to the rich menu with given ID.
+// LINE accepts a JPEG or PNG image that matches the size of the rich menu.
+func (adapter *Adapter) UploadRichMenuImageFromFile(ctx context.Context, richMenuID, path string) error {
+	// Uploading an image takes longer than other API calls.
+	reqCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	_, err := adapter.client.UploadRichMenuImage(richMenuID, path).WithContext(reqCtx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to upload rich menu image: %s", err.Error())
+	}
+
+	return nil
+}
+
+func (adapter *Adapter) linkRichMenu(ctx context.Context, userID, richMenuID string) error {
+	if adapter.capture != nil {
+		return nil
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := adapter.client.LinkUserRichMenu(userID, richMenuID).WithContext(reqCtx).Do()
+	if err != nil {
+		return fmt.Errorf("failed to link rich menu %s to user %s: %s", richMenuID, userID, err.Error())
+	}
+
+	return nil
+}
+
+// RichMenuContent represents a message that is sent along with the switch of the user's rich menu.
+// The rich menu is linked to the user only after the message is successfully sent.
+type RichMenuContent struct {
+	Message    linebot.SendingMessage
+	UserID     string
+	RichMenuID string
+}
+
+// NewResponseWithRichMenu creates new sarah.CommandResponse instance that sends given message and then links the rich menu with given ID to the user.
+// This is handy when the rich menu reflects the conversational state such as logged-in or logged-out,
+// since the menu switch is coupled with the message that tells the change.
+//
+// An error is returned when given input is not sent from a user; a rich menu can not be linked to a group or room.
+func NewResponseWithRichMenu(input sarah.Input, message linebot.SendingMessage, richMenuID string) (*sarah.CommandResponse, error) {
+	if !IsSourceUser(input) {
+		return nil, fmt.Errorf("rich menu can only be linked to a user, but %T is not sent from a user", input)
+	}
+
+	ider, ok := input.(ConversationIDer)
+	if !ok {
+		return nil, fmt.Errorf("user ID can not be obtained from %T", input)
+	}
+
+	return &sarah.CommandResponse{
+		Content: &RichMenuContent{
+			Message:    message,
+			UserID:     ider.ConversationID(),
+			RichMenuID: richMenuID,
+		},
+		UserContext: nil,
+	}, nil
+}
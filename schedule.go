@@ -0,0 +1,292 @@
+package line
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2/log"
+	"sync"
+	"time"
+)
+
+// ErrSchedulerStopped indicates that a push can not be scheduled because the context given to Adapter.Run is already canceled.
+var ErrSchedulerStopped = errors.New("push scheduler is already stopped")
+
+// scheduler holds pushes that are waiting for their scheduled time.
+// All pending pushes are canceled when the context given to Adapter.Run is canceled so none of them fires after shutdown.
+type scheduler struct {
+	mutex   sync.Mutex
+	stopped bool
+	pending map[*pendingPush]struct{}
+}
+
+type pendingPush struct {
+	cancel context.CancelFunc
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{
+		pending: map[*pendingPush]struct{}{},
+	}
+}
+
+// add derives a cancelable context from given one and registers it as a pending push.
+// The returned function must be called when the push is done or canceled.
+func (s *scheduler) add(ctx context.Context) (context.Context, func(), error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.stopped {
+		return nil, nil, ErrSchedulerStopped
+	}
+
+	pushCtx, cancel := context.WithCancel(ctx)
+	p := &pendingPush{cancel: cancel}
+	s.pending[p] = struct{}{}
+	done := func() {
+		cancel()
+		s.mutex.Lock()
+		delete(s.pending, p)
+		s.mutex.Unlock()
+	}
+	return pushCtx, done, nil
+}
+
+// stop cancels all pending pushes and rejects further scheduling.
+func (s *scheduler) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.stopped = true
+	for p := range s.pending {
+		p.cancel()
+	}
+	s.pending = map[*pendingPush]struct{}{}
+}
+
+// isStopped tells if the scheduler is stopped because the context given to Adapter.Run is canceled.
+func (s *scheduler) isStopped() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.stopped
+}
+
+// scheduledPushKeyPrefix is the prefix of Store keys that hold pending scheduled pushes.
+const scheduledPushKeyPrefix = "line:scheduled_push:"
+
+// scheduledPushRetention is how long a scheduled push is kept in Store after its scheduled time,
+// so a push that became due while the process was down can still be restored.
+const scheduledPushRetention = 24 * time.Hour
+
+// scheduledPush is the serialized form of a scheduled push held in Store.
+type scheduledPush struct {
+	To       string            `json:"to"`
+	At       time.Time         `json:"at"`
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// storedMessage is linebot.SendingMessage restored from its serialized form in Store.
+// The serialized JSON is sent to LINE as-is.
+type storedMessage json.RawMessage
+
+var _ linebot.SendingMessage = storedMessage(nil)
+
+// Message implements linebot.Message.
+func (m storedMessage) Message() {}
+
+// WithQuickReplies returns the message as-is since the quick reply items, if any, are already included in the serialized form.
+func (m storedMessage) WithQuickReplies(*linebot.QuickReplyItems) linebot.SendingMessage {
+	return m
+}
+
+// MarshalJSON returns the serialized form of the original message.
+func (m storedMessage) MarshalJSON() ([]byte, error) {
+	return m, nil
+}
+
+// SchedulePush pushes given messages to the user, room, or group with given ID at the given time.
+// This is handy to implement a reminder that is set conversationally such as "remind me in 10 minutes."
+//
+//	err := adapter.SchedulePush(ctx, time.Now().Add(10*time.Minute), input.(line.ConversationIDer).ConversationID(), linebot.NewTextMessage("Time is up!"))
+//
+// The push is canceled when given context is canceled before the scheduled time, or when the context given to Adapter.Run is canceled.
+// The push is also held in the Store given via WithStore until it is sent or canceled with given context;
+// call RestoreScheduledPushes on start to resume the pushes left by the previous process.
+// An error on the push is escalated to go-sarah's core as *SendingError just like other messages.
+func (adapter *Adapter) SchedulePush(ctx context.Context, at time.Time, to string, messages ...linebot.SendingMessage) error {
+	if len(messages) == 0 {
+		return errors.New("no message is given to schedule")
+	}
+	if len(messages) > maxMessagesPerCall {
+		return fmt.Errorf("can not schedule %d messages at once. maximum is %d", len(messages), maxMessagesPerCall)
+	}
+
+	push := &scheduledPush{
+		To: to,
+		At: at,
+	}
+	for _, message := range messages {
+		serialized, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("failed to serialize message: %s", err.Error())
+		}
+		push.Messages = append(push.Messages, serialized)
+	}
+
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Errorf("failed to generate scheduled push ID: %s", err.Error())
+	}
+	key := scheduledPushKeyPrefix + hex.EncodeToString(b)
+
+	value, err := json.Marshal(push)
+	if err != nil {
+		return fmt.Errorf("failed to serialize scheduled push: %s", err.Error())
+	}
+	err = adapter.store.Put(ctx, key, value, time.Until(at)+scheduledPushRetention)
+	if err != nil {
+		return fmt.Errorf("failed to store scheduled push: %s", err.Error())
+	}
+
+	err = adapter.schedule(ctx, key, push)
+	if err != nil {
+		_, _ = adapter.store.Delete(ctx, key)
+		return err
+	}
+	return nil
+}
+
+// RestoreScheduledPushes schedules the pushes held in the Store given via WithStore again, and returns the number of restored pushes.
+// The pushes are held across process restarts only when the Store persists the values outside of the process; the default in-memory Store does not.
+// A push whose scheduled time has already passed is sent immediately.
+//
+// Call this on start, before or after Adapter.Run. When multiple bot instances share the Store, each of them may call this;
+// every instance waits for the same push, but only the one that claims the push by deleting it from the Store sends it.
+// The restored pushes are canceled when given context is canceled just like the ones scheduled by SchedulePush,
+// so give a context that lives as long as the pushes should.
+// They are also canceled when the context given to Adapter.Run is canceled, and then they stay in the Store so they can be restored again.
+func (adapter *Adapter) RestoreScheduledPushes(ctx context.Context) (int, error) {
+	keys, err := adapter.store.Keys(ctx, scheduledPushKeyPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list scheduled pushes: %s", err.Error())
+	}
+
+	restored := 0
+	for _, key := range keys {
+		value, ok, err := adapter.store.Get(ctx, key)
+		if err != nil {
+			return restored, fmt.Errorf("failed to get scheduled push %s: %s", key, err.Error())
+		}
+		if !ok {
+			// Sent or canceled in the meantime.
+			continue
+		}
+
+		push := &scheduledPush{}
+		err = json.Unmarshal(value, push)
+		if err != nil {
+			log.Errorf("Failed to deserialize scheduled push %s. Push is dropped: %s.", key, err.Error())
+			_, _ = adapter.store.Delete(ctx, key)
+			continue
+		}
+
+		err = adapter.schedule(ctx, key, push)
+		if err != nil {
+			return restored, err
+		}
+		restored++
+	}
+
+	return restored, nil
+}
+
+// schedule waits until the scheduled time and sends the push held in Store with given key.
+// The key is deleted when the push is sent or canceled with given context, but is kept when the context given to Adapter.Run is canceled
+// so the push can be restored by the next process.
+// The push is sent only when this call deletes the key, so a push restored by multiple instances or restored twice is sent once.
+func (adapter *Adapter) schedule(ctx context.Context, key string, push *scheduledPush) error {
+	pushCtx, done, err := adapter.scheduler.add(ctx)
+	if err != nil {
+		return err
+	}
+
+	var messages []linebot.SendingMessage
+	for _, message := range push.Messages {
+		messages = append(messages, storedMessage(message))
+	}
+
+	go func() {
+		defer done()
+
+		timer := time.NewTimer(time.Until(push.At))
+		defer timer.Stop()
+
+		select {
+		case <-pushCtx.Done():
+			log.Infof("Scheduled push to %s is canceled: %s.", push.To, pushCtx.Err().Error())
+			if !adapter.scheduler.isStopped() {
+				// Canceled by the caller rather than by the shutdown.
+				// Given context is already canceled, so access the Store with one that keeps its values but not its cancellation.
+				_, _ = adapter.deleteScheduledPush(detachedContext{pushCtx}, key)
+			}
+			return
+
+		case <-timer.C:
+			// Time to push.
+
+		}
+
+		// Delete before sending so the push is not sent again when it is restored after a crash.
+		claimed, err := adapter.deleteScheduledPush(pushCtx, key)
+		if err != nil || !claimed {
+			// Sent by another instance or canceled in the meantime, or the claim is unknown.
+			// Not sending is safer than sending the same push twice.
+			return
+		}
+
+		err = adapter.push(pushCtx, push.To, messages)
+		if err != nil {
+			log.Errorf("Failed to send scheduled push to %s: %s.", push.To, err.Error())
+			adapter.escalate(&SendingError{
+				Destination: PushDestination(push.To),
+				Err:         err,
+			})
+		}
+	}()
+
+	return nil
+}
+
+// deleteScheduledPush deletes the scheduled push with given key from Store and reports whether the push was still stored.
+func (adapter *Adapter) deleteScheduledPush(ctx context.Context, key string) (bool, error) {
+	deleted, err := adapter.store.Delete(ctx, key)
+	if err != nil {
+		log.Errorf("Failed to delete scheduled push %s: %s.", key, err.Error())
+		return false, err
+	}
+	return deleted, nil
+}
+
+// detachedContext is a context.Context that carries the values of the wrapped context but is never canceled.
+// This is used to clean up the Store after the context of the operation is canceled.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
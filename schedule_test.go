@@ -0,0 +1,50 @@
+package line_test
+
+import (
+	"context"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah-line"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdapter_RestoreScheduledPushes_SendOnce(t *testing.T) {
+	api := &stubAPI{}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+	config.APIEndpointBase = server.URL
+	adapter, err := line.NewAdapter(config)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	err = adapter.SchedulePush(ctx, time.Now().Add(50*time.Millisecond), "U123", linebot.NewTextMessage("Time is up!"))
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	// Restoring while the push is still waiting schedules the same push again, just like another instance sharing the Store does.
+	restored, err := adapter.RestoreScheduledPushes(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+	if restored != 1 {
+		t.Fatalf("Expected 1 push to be restored, but was %d.", restored)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if api.calls != 1 {
+		t.Errorf("Expected the push to be sent once, but was %d.", api.calls)
+	}
+}
@@ -0,0 +1,110 @@
+package line
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store is an interface that persists values for the adapter's stateful features.
+// The adapter uses this to hold the contents served by HostTemporaryContent and the pending pushes scheduled by SchedulePush by default in memory,
+// but a Store backed by Redis or such can be given via WithStore so multiple bot instances behind a load balancer share the state.
+type Store interface {
+	// Put stores given value with given key. The value must not be returned by Get after the ttl.
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+
+	// Get returns the value stored with given key. false is returned when no value is stored or the value is expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Delete removes the value stored with given key and reports whether a value that is not expired was stored.
+	// This must not return an error when no value is stored.
+	//
+	// The adapter claims a scheduled push by deleting it and sends the push only when true is returned,
+	// so when multiple bot instances share the Store, only one of concurrent callers must get true for the same value.
+	Delete(ctx context.Context, key string) (bool, error)
+
+	// Keys returns the keys of the values that start with given prefix and are not expired.
+	Keys(ctx context.Context, prefix string) ([]string, error)
+}
+
+type storedValue struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// inMemoryStore is the default Store that holds values in the process memory.
+type inMemoryStore struct {
+	mutex  sync.Mutex
+	values map[string]*storedValue
+}
+
+var _ Store = (*inMemoryStore)(nil)
+
+// NewInMemoryStore creates new Store that holds values in the process memory.
+// Values are lost when the process exits, and are not shared with other processes.
+func NewInMemoryStore() Store {
+	return &inMemoryStore{
+		values: map[string]*storedValue{},
+	}
+}
+
+func (s *inMemoryStore) Put(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Sweep expired values here so they do not pile up in memory.
+	now := time.Now()
+	for k, v := range s.values {
+		if now.After(v.expiresAt) {
+			delete(s.values, k)
+		}
+	}
+
+	s.values[key] = &storedValue{
+		value:     value,
+		expiresAt: now.Add(ttl),
+	}
+	return nil
+}
+
+func (s *inMemoryStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, ok := s.values[key]
+	if !ok {
+		return nil, false, nil
+	}
+	if time.Now().After(v.expiresAt) {
+		delete(s.values, key)
+		return nil, false, nil
+	}
+	return v.value, true, nil
+}
+
+func (s *inMemoryStore) Delete(_ context.Context, key string) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	v, ok := s.values[key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.values, key)
+	return !time.Now().After(v.expiresAt), nil
+}
+
+func (s *inMemoryStore) Keys(_ context.Context, prefix string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var keys []string
+	now := time.Now()
+	for k, v := range s.values {
+		if strings.HasPrefix(k, prefix) && !now.After(v.expiresAt) {
+			keys = append(keys, k)
+		}
+	}
+	return keys, nil
+}
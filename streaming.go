@@ -0,0 +1,183 @@
+package line
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrStreamingResponderClosed is returned when StreamingResponder is used after StreamingResponder.Close is called.
+var ErrStreamingResponderClosed = errors.New("streaming responder is already closed")
+
+// StreamingResponder coalesces streamed text chunks, such as tokens from an LLM, into a limited number of text messages.
+//
+// LINE does not support any kind of streaming response, so each flush results in a new message.
+// The first message is sent as a reply with the input's reply token; since a reply token is single-use, the subsequent messages are pushed.
+// To avoid flooding the conversation, the number of messages is capped and flushes are throttled with the given interval.
+//
+//	responder, err := adapter.NewStreamingResponder(input, 3, 2*time.Second)
+//	if err != nil {
+//		return nil, err
+//	}
+//	for chunk := range stream {
+//		responder.Write(chunk)
+//		_ = responder.Flush(ctx)
+//	}
+//	err = responder.Close(ctx)
+type StreamingResponder struct {
+	adapter        *Adapter
+	replyToken     string
+	conversationID string
+	maxMessages    int
+	interval       time.Duration
+
+	bufMutex sync.Mutex
+	buf      strings.Builder
+
+	sendMutex sync.Mutex
+	sent      int
+	lastSent  time.Time
+	closed    bool
+}
+
+// NewStreamingResponder creates new StreamingResponder for given input.
+// At most maxMessages messages are sent in total; Flush does not send the last one so the remainder is always delivered by Close.
+// Consecutive messages are sent at least the given interval apart.
+// Messages are sent by the Adapter directly, so a decorator built on AdapterInterface does not intercept them.
+func (adapter *Adapter) NewStreamingResponder(input sarah.Input, maxMessages int, interval time.Duration) (*StreamingResponder, error) {
+	if maxMessages < 1 {
+		return nil, fmt.Errorf("maximum number of messages must be positive: %d", maxMessages)
+	}
+
+	replyToken, ok := input.ReplyTo().(string)
+	if !ok {
+		return nil, fmt.Errorf("reply token can not be obtained from %T", input)
+	}
+
+	ider, ok := input.(ConversationIDer)
+	if !ok {
+		return nil, fmt.Errorf("conversation ID can not be obtained from %T", input)
+	}
+
+	return &StreamingResponder{
+		adapter:        adapter,
+		replyToken:     replyToken,
+		conversationID: ider.ConversationID(),
+		maxMessages:    maxMessages,
+		interval:       interval,
+	}, nil
+}
+
+// Write appends given chunk to the internal buffer.
+// Nothing is sent until Flush or Close is called.
+func (r *StreamingResponder) Write(chunk string) {
+	r.bufMutex.Lock()
+	defer r.bufMutex.Unlock()
+
+	r.buf.WriteString(chunk)
+}
+
+// Flush sends the buffered text as a new message.
+// This waits until the configured interval passes since the last message, or returns the context's error when ctx is canceled first.
+// When only one message is left to send, the text stays in the buffer and is delivered by Close.
+// Text beyond 5000 characters, or all of the text when the message can not be sent, also stays in the buffer for the next call.
+func (r *StreamingResponder) Flush(ctx context.Context) error {
+	r.sendMutex.Lock()
+	defer r.sendMutex.Unlock()
+
+	if r.closed {
+		return ErrStreamingResponderClosed
+	}
+
+	if r.sent >= r.maxMessages-1 {
+		// Reserve the last message for Close.
+		return nil
+	}
+
+	return r.send(ctx, 1)
+}
+
+// Close sends whatever remains in the buffer as the last message.
+// A remainder longer than 5000 characters is split with SplitText into as many messages as maxMessages still allows, up to 5;
+// the text beyond that is dropped.
+// StreamingResponder can not be used after this call returns nil.
+// On error, the remainder stays in the buffer so Close can be called again.
+func (r *StreamingResponder) Close(ctx context.Context) error {
+	r.sendMutex.Lock()
+	defer r.sendMutex.Unlock()
+
+	if r.closed {
+		return ErrStreamingResponderClosed
+	}
+
+	err := r.send(ctx, r.maxMessages-r.sent)
+	if err != nil {
+		return err
+	}
+
+	r.closed = true
+	return nil
+}
+
+// send sends the buffered text in maxMessages messages or less, each of which contains 5000 characters or less.
+// The sent text is removed from the buffer only when the call succeeds; text written in the meantime is kept.
+func (r *StreamingResponder) send(ctx context.Context, maxMessages int) error {
+	r.bufMutex.Lock()
+	empty := r.buf.Len() == 0
+	r.bufMutex.Unlock()
+	if empty {
+		return nil
+	}
+
+	if !r.lastSent.IsZero() {
+		wait := r.interval - time.Since(r.lastSent)
+		if wait > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+
+			case <-time.After(wait):
+				// O.K.
+
+			}
+		}
+	}
+
+	r.bufMutex.Lock()
+	text := r.buf.String()
+	r.bufMutex.Unlock()
+
+	messages := SplitText(text, 0)
+	if len(messages) > maxMessages {
+		messages = messages[:maxMessages]
+	}
+	sentLength := 0
+	for _, message := range messages {
+		sentLength += len(message.(*linebot.TextMessage).Text)
+	}
+
+	var err error
+	if r.sent == 0 {
+		err = r.adapter.reply(ctx, r.replyToken, messages)
+	} else {
+		err = r.adapter.push(ctx, r.conversationID, messages)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.bufMutex.Lock()
+	remaining := r.buf.String()[sentLength:]
+	r.buf.Reset()
+	r.buf.WriteString(remaining)
+	r.bufMutex.Unlock()
+
+	r.sent += len(messages)
+	r.lastSent = time.Now()
+	return nil
+}
@@ -0,0 +1,120 @@
+package line_test
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah-line"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubAPI records the texts sent to the messaging API and fails the calls listed in failAt.
+type stubAPI struct {
+	mutex  sync.Mutex
+	calls  int
+	failAt map[int]bool
+	texts  [][]string
+}
+
+func (s *stubAPI) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	call := s.calls
+	s.calls++
+	if s.failAt[call] {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"message": "stub failure"}`))
+		return
+	}
+
+	body := &struct {
+		Messages []struct {
+			Text string `json:"text"`
+		} `json:"messages"`
+	}{}
+	_ = json.NewDecoder(req.Body).Decode(body)
+	var texts []string
+	for _, message := range body.Messages {
+		texts = append(texts, message.Text)
+	}
+	s.texts = append(s.texts, texts)
+	_, _ = w.Write([]byte(`{}`))
+}
+
+// newStreamingResponder creates StreamingResponder that talks to given stub. The returned server must be closed by the caller.
+func newStreamingResponder(t *testing.T, api *stubAPI, maxMessages int) (*line.StreamingResponder, *httptest.Server) {
+	server := httptest.NewServer(api)
+
+	config := line.NewConfig()
+	config.ChannelToken = "token"
+	config.ChannelSecret = "secret"
+	config.APIEndpointBase = server.URL
+	adapter, err := line.NewAdapter(config)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	input, err := line.EventToUserInput(config, &linebot.Event{
+		Type:       linebot.EventTypeMessage,
+		ReplyToken: "replyToken",
+		Timestamp:  time.Now(),
+		Source:     &linebot.EventSource{Type: linebot.EventSourceTypeUser, UserID: "U"},
+		Message:    &linebot.TextMessage{ID: "1", Text: "question"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	responder, err := adapter.NewStreamingResponder(input, maxMessages, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+	return responder, server
+}
+
+func TestStreamingResponder_KeepBufferOnError(t *testing.T) {
+	api := &stubAPI{failAt: map[int]bool{0: true}}
+	responder, server := newStreamingResponder(t, api, 3)
+	defer server.Close()
+
+	responder.Write("hello ")
+	err := responder.Flush(context.TODO())
+	if err == nil {
+		t.Fatal("Expected error is not returned.")
+	}
+
+	responder.Write("world")
+	err = responder.Close(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	if len(api.texts) != 1 || len(api.texts[0]) != 1 || api.texts[0][0] != "hello world" {
+		t.Errorf("Unexpected texts are sent: %#v.", api.texts)
+	}
+}
+
+func TestStreamingResponder_SplitLongRemainder(t *testing.T) {
+	api := &stubAPI{}
+	responder, server := newStreamingResponder(t, api, 3)
+	defer server.Close()
+
+	responder.Write(strings.Repeat("a", 6000))
+	err := responder.Close(context.TODO())
+	if err != nil {
+		t.Fatalf("Unexpected error is returned: %s.", err.Error())
+	}
+
+	if len(api.texts) != 1 {
+		t.Fatalf("Expected 1 call, but was %d.", len(api.texts))
+	}
+	if len(api.texts[0]) != 2 || len(api.texts[0][0]) != 5000 || len(api.texts[0][1]) != 1000 {
+		t.Errorf("Remainder is not split into messages of 5000 characters or less: %d messages.", len(api.texts[0]))
+	}
+}
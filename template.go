@@ -0,0 +1,88 @@
+package line
+
+import (
+	"errors"
+	"fmt"
+	"github.com/line/line-bot-sdk-go/linebot"
+	"github.com/oklahomer/go-sarah/v2"
+	"strings"
+)
+
+// maxButtonsTemplateActions is the maximum number of actions a buttons template can contain.
+const maxButtonsTemplateActions = 4
+
+// NewButtonsResponse creates new sarah.CommandResponse instance with a buttons template message.
+// Any kind of linebot.TemplateAction can be mixed, so "open website" and "do this in chat" buttons can be presented together.
+//
+//	line.NewButtonsResponse("Menu", "", "Menu", "What do you want to do?",
+//		linebot.NewURIAction("Open website", "https://example.com"),
+//		linebot.NewPostbackAction("Order", "action=order", "", "Order"),
+//		linebot.NewMessageAction("Help", ".help"))
+//
+// thumbnailImageURL and title are optional; pass empty strings to omit them.
+// An error is returned when no action or more than 4 actions are given, or when the thumbnail image URL is not acceptable.
+func NewButtonsResponse(altText, thumbnailImageURL, title, text string, actions ...linebot.TemplateAction) (*sarah.CommandResponse, error) {
+	if len(actions) == 0 {
+		return nil, errors.New("buttons template requires at least one action")
+	}
+	if len(actions) > maxButtonsTemplateActions {
+		return nil, fmt.Errorf("%d actions are given, but buttons template can contain %d actions at most", len(actions), maxButtonsTemplateActions)
+	}
+
+	if thumbnailImageURL != "" {
+		if err := validateMediaURL(thumbnailImageURL); err != nil {
+			return nil, err
+		}
+	}
+
+	template := linebot.NewButtonsTemplate(thumbnailImageURL, title, text, actions...)
+	return &sarah.CommandResponse{
+		Content:     linebot.NewTemplateMessage(altText, template),
+		UserContext: nil,
+	}, nil
+}
+
+// NewDatetimePickerResponse creates new sarah.CommandResponse instance with a buttons template that prompts the user to pick a date and/or time.
+// mode is one of "date", "time", and "datetime." The picked value is delivered as a postback with given data;
+// use PostbackEvent.DatetimePicked to obtain the value.
+//
+//	line.NewDatetimePickerResponse("Pick a date", "When would you like to visit?", "Pick a date", "action=reserve", "date")
+//
+// Use linebot.NewDatetimePickerAction with NewButtonsResponse to set the initial, maximum, or minimum value.
+// An error is returned when the mode is invalid.
+func NewDatetimePickerResponse(altText, text, label, data, mode string) (*sarah.CommandResponse, error) {
+	switch mode {
+	case "date", "time", "datetime":
+		// Valid mode.
+
+	default:
+		return nil, fmt.Errorf("mode must be one of date, time, and datetime, but %q is given", mode)
+
+	}
+
+	action := linebot.NewDatetimePickerAction(label, data, mode, "", "", "")
+	return NewButtonsResponse(altText, "", "", text, action)
+}
+
+// liffURLBase is the base of the URL that opens a LIFF app.
+const liffURLBase = "https://liff.line.me/"
+
+// NewLIFFResponse creates new sarah.CommandResponse instance with a buttons template whose button opens the LIFF app with given ID.
+// path is appended to the LIFF URL so the app can navigate to a specific page; pass an empty string to open the app's endpoint as-is.
+//
+//	line.NewLIFFResponse("Check your order.", "Open", "1234567890-AbcdEfgh", "orders/123")
+//
+// The button opens https://liff.line.me/1234567890-AbcdEfgh/orders/123 in this case.
+// An error is returned when the LIFF ID is empty.
+func NewLIFFResponse(text, label, liffID, path string) (*sarah.CommandResponse, error) {
+	if liffID == "" {
+		return nil, errors.New("LIFF ID is required")
+	}
+
+	uri := liffURLBase + liffID
+	if path = strings.TrimPrefix(path, "/"); path != "" {
+		uri += "/" + path
+	}
+
+	return NewButtonsResponse(text, "", "", text, linebot.NewURIAction(label, uri))
+}
@@ -0,0 +1,56 @@
+package line
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+	"strings"
+)
+
+// sentenceTerminators are the characters after which a text can be split naturally when no line break is found.
+const sentenceTerminators = ".!?。！？"
+
+// SplitText splits given text into text messages so each message contains maxLen characters or less.
+// A text is split at the last line break within the limit, or at the last end of a sentence when there is no line break.
+// Characters are counted in runes, so a multibyte character is never split.
+//
+//	return &sarah.CommandResponse{Content: line.SplitText(longText, 0)}, nil
+//
+// When maxLen is not positive or exceeds 5000, which is the limit of a text message, 5000 is used.
+// At most 5 messages are returned since that is the limit of a single reply; the rest of the text is dropped.
+func SplitText(text string, maxLen int) []linebot.SendingMessage {
+	if maxLen <= 0 || maxLen > maxTextLength {
+		maxLen = maxTextLength
+	}
+
+	var messages []linebot.SendingMessage
+	remaining := []rune(text)
+	for len(remaining) > 0 && len(messages) < maxMessagesPerCall {
+		if len(remaining) <= maxLen {
+			messages = append(messages, linebot.NewTextMessage(string(remaining)))
+			break
+		}
+
+		end := splitPoint(remaining[:maxLen])
+		messages = append(messages, linebot.NewTextMessage(string(remaining[:end])))
+		remaining = remaining[end:]
+	}
+
+	return messages
+}
+
+// splitPoint returns the index right after the last line break, or the last sentence terminator when no line break is found.
+// The length of given runes is returned when neither is found.
+func splitPoint(runes []rune) int {
+	for i := len(runes) - 1; i > 0; i-- {
+		if runes[i] == '\n' {
+			return i + 1
+		}
+	}
+
+	for i := len(runes) - 1; i > 0; i-- {
+		if strings.ContainsRune(sentenceTerminators, runes[i]) {
+			return i + 1
+		}
+	}
+
+	return len(runes)
+}
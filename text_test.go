@@ -0,0 +1,114 @@
+package line
+
+import (
+	"github.com/line/line-bot-sdk-go/linebot"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func texts(t *testing.T, messages []linebot.SendingMessage) []string {
+	var result []string
+	for i, message := range messages {
+		text, ok := message.(*linebot.TextMessage)
+		if !ok {
+			t.Fatalf("Unexpected message type is returned at index %d: %T.", i, message)
+		}
+		result = append(result, text.Text)
+	}
+	return result
+}
+
+func TestSplitText(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxLen   int
+		expected []string
+	}{
+		{
+			text:     "",
+			maxLen:   10,
+			expected: nil,
+		},
+		{
+			text:     "short",
+			maxLen:   10,
+			expected: []string{"short"},
+		},
+		{
+			text:     "first line\nsecond line",
+			maxLen:   15,
+			expected: []string{"first line\n", "second line"},
+		},
+		{
+			text:     "One. Two! Three?",
+			maxLen:   12,
+			expected: []string{"One. Two!", " Three?"},
+		},
+		{
+			// A line break is preferred over the end of a sentence.
+			text:     "a\nb. cde",
+			maxLen:   6,
+			expected: []string{"a\n", "b. cde"},
+		},
+		{
+			text:     "abcdefghij",
+			maxLen:   4,
+			expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			text:     "こんにちは。さようなら。",
+			maxLen:   8,
+			expected: []string{"こんにちは。", "さようなら。"},
+		},
+		{
+			text:     "あいうえおかきくけこ",
+			maxLen:   3,
+			expected: []string{"あいう", "えおか", "きくけ", "こ"},
+		},
+	}
+
+	for i, tt := range tests {
+		actual := texts(t, SplitText(tt.text, tt.maxLen))
+		if len(actual) != len(tt.expected) {
+			t.Errorf("Unexpected number of messages are returned on test #%d: %#v.", i, actual)
+			continue
+		}
+
+		for j := range tt.expected {
+			if actual[j] != tt.expected[j] {
+				t.Errorf("Expected %q at index %d on test #%d, but was %q.", tt.expected[j], j, i, actual[j])
+			}
+		}
+	}
+}
+
+func TestSplitText_DefaultMaxLen(t *testing.T) {
+	text := strings.Repeat("a", maxTextLength+1)
+	for _, maxLen := range []int{0, -1, maxTextLength + 1} {
+		actual := texts(t, SplitText(text, maxLen))
+		if len(actual) != 2 {
+			t.Errorf("Expected 2 messages with maxLen %d, but was %d.", maxLen, len(actual))
+			continue
+		}
+
+		if length := utf8.RuneCountInString(actual[0]); length != maxTextLength {
+			t.Errorf("Expected the first message to have %d characters with maxLen %d, but was %d.", maxTextLength, maxLen, length)
+		}
+	}
+}
+
+func TestSplitText_MaxMessages(t *testing.T) {
+	text := strings.Repeat("a", 10*maxMessagesPerCall)
+	actual := texts(t, SplitText(text, 5))
+
+	if len(actual) != maxMessagesPerCall {
+		t.Fatalf("Expected %d messages, but was %d.", maxMessagesPerCall, len(actual))
+	}
+
+	for i, text := range actual {
+		if text != "aaaaa" {
+			t.Errorf("Unexpected text is returned at index %d: %q.", i, text)
+		}
+	}
+}